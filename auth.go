@@ -0,0 +1,147 @@
+package protocol
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+)
+
+const (
+	AuthNone       byte = 0x00
+	AuthHMACSHA256 byte = 0x01
+	AuthEd25519    byte = 0x02
+)
+
+var signatureSizes = map[byte]int{
+	AuthNone:       0,
+	AuthHMACSHA256: sha256.Size,
+	AuthEd25519:    ed25519.SignatureSize,
+}
+
+type KeyProvider interface {
+	HMACKey(keyID string) ([]byte, error)
+	Ed25519PublicKey(keyID string) (ed25519.PublicKey, error)
+}
+
+type KeyRing struct {
+	mu          sync.RWMutex
+	hmacKeys    map[string][]byte
+	ed25519Keys map[string]ed25519.PublicKey
+}
+
+func NewKeyRing() *KeyRing {
+	return &KeyRing{
+		hmacKeys:    make(map[string][]byte),
+		ed25519Keys: make(map[string]ed25519.PublicKey),
+	}
+}
+
+func (k *KeyRing) AddHMACKey(keyID string, secret []byte) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.hmacKeys[keyID] = secret
+}
+
+func (k *KeyRing) AddEd25519PublicKey(keyID string, key ed25519.PublicKey) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.ed25519Keys[keyID] = key
+}
+
+func (k *KeyRing) RemoveKey(keyID string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.hmacKeys, keyID)
+	delete(k.ed25519Keys, keyID)
+}
+
+func (k *KeyRing) HMACKey(keyID string) ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.hmacKeys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+	}
+	return key, nil
+}
+
+func (k *KeyRing) Ed25519PublicKey(keyID string) (ed25519.PublicKey, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.ed25519Keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+	}
+	return key, nil
+}
+
+type signingKey struct {
+	mode  byte
+	keyID string
+	key   []byte
+}
+
+func (k *signingKey) sign(data []byte) ([]byte, error) {
+	switch k.mode {
+	case AuthHMACSHA256:
+		mac := hmac.New(sha256.New, k.key)
+		mac.Write(data)
+		return mac.Sum(nil), nil
+	case AuthEd25519:
+		if len(k.key) != ed25519.PrivateKeySize {
+			return nil, fmt.Errorf("invalid ed25519 private key of %d bytes", len(k.key))
+		}
+		return ed25519.Sign(ed25519.PrivateKey(k.key), data), nil
+	}
+	return nil, fmt.Errorf("unknown authentication mode %d", k.mode)
+}
+
+func authenticateMessage(data []byte, signature []byte, mode byte, keyID string, provider KeyProvider) error {
+	if mode == AuthNone {
+		if provider != nil {
+			return &AuthenticationError{err: ErrUnauthenticated}
+		}
+		return nil
+	}
+
+	err := verifySignature(data, signature, mode, keyID, provider)
+	if err != nil {
+		return &AuthenticationError{Mode: mode, KeyID: keyID, err: err}
+	}
+	return nil
+}
+
+func verifySignature(data []byte, signature []byte, mode byte, keyID string, provider KeyProvider) error {
+	if provider == nil {
+		return ErrNoKeyProvider
+	}
+
+	switch mode {
+	case AuthHMACSHA256:
+		key, err := provider.HMACKey(keyID)
+		if err != nil {
+			return err
+		}
+		mac := hmac.New(sha256.New, key)
+		mac.Write(data)
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return ErrSignatureMismatch
+		}
+		return nil
+	case AuthEd25519:
+		key, err := provider.Ed25519PublicKey(keyID)
+		if err != nil {
+			return err
+		}
+		if len(key) != ed25519.PublicKeySize {
+			return fmt.Errorf("invalid ed25519 public key of %d bytes", len(key))
+		}
+		if !ed25519.Verify(key, data, signature) {
+			return ErrSignatureMismatch
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown authentication mode %d", mode)
+}
@@ -0,0 +1,191 @@
+package protocol
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"testing"
+)
+
+func TestAuthentication(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	keys := NewKeyRing()
+	keys.AddHMACKey("hmac", []byte("secret"))
+	keys.AddEd25519PublicKey("ed25519", publicKey)
+
+	tests := []struct {
+		name    string
+		mode    byte
+		signing Option
+	}{
+		{"hmac", AuthHMACSHA256, HMACSigningKey("hmac", []byte("secret"))},
+		{"ed25519", AuthEd25519, Ed25519SigningKey("ed25519", privateKey)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, compression := range []bool{false, true} {
+				options := Options(tt.signing, VerificationKeys(keys), Compression(compression), RequestID(7))
+				data, err := EncodeFunctionCall("call", options, map[string]any{"str": "moin", "list": []int{1, 2}})
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if data[authOffset] != tt.mode {
+					t.Fatalf("expected auth byte %d, got %d", tt.mode, data[authOffset])
+				}
+
+				name, args, err := DecodeFunctionCall(data, options)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if name != "call" || args["str"].Value != "moin" {
+					t.Fatalf("unexpected call %q: %v", name, args)
+				}
+
+				tampered := withFixedChecksum(bytes.Replace(data, []byte("call"), []byte("cell"), 1))
+				_, _, err = DecodeFunctionCall(tampered, options)
+				var authenticationErr *AuthenticationError
+				if !errors.As(err, &authenticationErr) || !errors.Is(err, ErrSignatureMismatch) {
+					t.Fatalf("expected signature mismatch, got: %v", err)
+				}
+				if authenticationErr.Mode != tt.mode || authenticationErr.KeyID != tt.name {
+					t.Fatalf("unexpected authentication error: %+v", authenticationErr)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthenticationErrors(t *testing.T) {
+	keys := NewKeyRing()
+	keys.AddHMACKey("current", []byte("secret"))
+
+	signed, err := EncodeFunctionCall("call", Options(HMACSigningKey("current", []byte("secret"))), map[string]any{"a": 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	unknown, err := EncodeFunctionCall("call", Options(HMACSigningKey("unknown", []byte("secret"))), map[string]any{"a": 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wrongSecret, err := EncodeFunctionCall("call", Options(HMACSigningKey("current", []byte("other"))), map[string]any{"a": 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	unsigned, err := EncodeFunctionCall("call", Options(), map[string]any{"a": 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	unknownMode := bytes.Clone(signed)
+	unknownMode[authOffset] = 0x7F
+	unknownMode = withFixedChecksum(unknownMode)
+
+	tests := []struct {
+		name     string
+		data     []byte
+		options  *options
+		expected error
+	}{
+		{"unknown key", unknown, Options(VerificationKeys(keys)), ErrUnknownKey},
+		{"wrong secret", wrongSecret, Options(VerificationKeys(keys)), ErrSignatureMismatch},
+		{"unauthenticated", unsigned, Options(VerificationKeys(keys)), ErrUnauthenticated},
+		{"no key provider", signed, Options(), ErrNoKeyProvider},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := DecodeFunctionCall(tt.data, tt.options)
+			var authenticationErr *AuthenticationError
+			if !errors.As(err, &authenticationErr) || !errors.Is(err, tt.expected) {
+				t.Fatalf("expected %v, got: %v", tt.expected, err)
+			}
+		})
+	}
+
+	t.Run("unknown mode", func(t *testing.T) {
+		_, _, err := DecodeFunctionCall(unknownMode, Options(VerificationKeys(keys)))
+		var decodingErr *DecodingError
+		if !errors.As(err, &decodingErr) || decodingErr.Offset != authOffset {
+			t.Fatalf("expected DecodingError at offset %d, got: %v", authOffset, err)
+		}
+	})
+
+	t.Run("invalid private key", func(t *testing.T) {
+		_, err := EncodeFunctionCall("call", Options(Ed25519SigningKey("key", ed25519.PrivateKey("short"))), map[string]any{})
+		var encodingErr *EncodingError
+		if !errors.As(err, &encodingErr) {
+			t.Fatalf("expected EncodingError, got: %v", err)
+		}
+	})
+}
+
+func TestKeyRotation(t *testing.T) {
+	keys := NewKeyRing()
+	keys.AddHMACKey("old", []byte("old secret"))
+	old, err := EncodeFunctionCall("call", Options(HMACSigningKey("old", []byte("old secret"))), map[string]any{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	keys.AddHMACKey("new", []byte("new secret"))
+	current, err := EncodeFunctionCall("call", Options(HMACSigningKey("new", []byte("new secret"))), map[string]any{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	options := Options(VerificationKeys(keys))
+	for _, data := range [][]byte{old, current} {
+		_, _, err = DecodeFunctionCall(data, options)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	keys.RemoveKey("old")
+	_, _, err = DecodeFunctionCall(old, options)
+	if !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("expected unknown key, got: %v", err)
+	}
+	_, _, err = DecodeFunctionCall(current, options)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestAuthenticatedServer(t *testing.T) {
+	keys := NewKeyRing()
+	keys.AddHMACKey("key", []byte("secret"))
+	options := Options(HMACSigningKey("key", []byte("secret")), VerificationKeys(keys))
+
+	server := NewServer(options)
+	_ = server.Register("add", func(a, b int) int { return a + b }, "a", "b")
+
+	call, err := EncodeFunctionCall("add", options, map[string]any{"a": 1, "b": 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	response, err := server.Handle(context.Background(), call)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, results, err := DecodeFunctionResult(response, options)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if results["0"].Value != 3 {
+		t.Fatalf("expected 3, got %v", results["0"].Value)
+	}
+
+	unsigned, err := EncodeFunctionCall("add", Options(), map[string]any{"a": 1, "b": 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = server.Handle(context.Background(), unsigned)
+	if !errors.Is(err, ErrUnauthenticated) {
+		t.Fatalf("expected unauthenticated error, got: %v", err)
+	}
+}
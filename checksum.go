@@ -0,0 +1,85 @@
+package protocol
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"hash/crc64"
+)
+
+const (
+	ChecksumCRC32  byte = 0x00
+	ChecksumCRC32C byte = 0x01
+	ChecksumCRC64  byte = 0x02
+	ChecksumSHA256 byte = 0x03
+)
+
+const (
+	ArgumentChecksumsAll      byte = 0x00
+	ArgumentChecksumsTopLevel byte = 0x01
+	ArgumentChecksumsNone     byte = 0x02
+)
+
+type checksum struct {
+	size int
+	sum  func(data []byte) []byte
+}
+
+var (
+	castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+	crc64Table      = crc64.MakeTable(crc64.ECMA)
+)
+
+var noChecksum = &checksum{size: 0, sum: func(data []byte) []byte {
+	return nil
+}}
+
+var checksums = map[byte]*checksum{
+	ChecksumCRC32: {size: 4, sum: func(data []byte) []byte {
+		return binary.BigEndian.AppendUint32(nil, crc32.ChecksumIEEE(data))
+	}},
+	ChecksumCRC32C: {size: 4, sum: func(data []byte) []byte {
+		return binary.BigEndian.AppendUint32(nil, crc32.Checksum(data, castagnoliTable))
+	}},
+	ChecksumCRC64: {size: 8, sum: func(data []byte) []byte {
+		return binary.BigEndian.AppendUint64(nil, crc64.Checksum(data, crc64Table))
+	}},
+	ChecksumSHA256: {size: sha256.Size, sum: func(data []byte) []byte {
+		sum := sha256.Sum256(data)
+		return sum[:]
+	}},
+}
+
+func checksumByID(id byte) (*checksum, error) {
+	algorithm, ok := checksums[id]
+	if !ok {
+		return nil, &UnknownChecksumError{ID: id}
+	}
+	return algorithm, nil
+}
+
+func argumentChecksums(algorithm *checksum, mode byte) (topLevel *checksum, nested *checksum, err error) {
+	switch mode {
+	case ArgumentChecksumsAll:
+		return algorithm, algorithm, nil
+	case ArgumentChecksumsTopLevel:
+		return algorithm, noChecksum, nil
+	case ArgumentChecksumsNone:
+		return noChecksum, noChecksum, nil
+	}
+	return nil, nil, fmt.Errorf("unknown argument checksum mode %d", mode)
+}
+
+func writeChecksum(buffer *bytes.Buffer, algorithm *checksum) error {
+	_, err := buffer.Write(algorithm.sum(buffer.Bytes()))
+	return err
+}
+
+func verifyChecksum(data []byte, checksum []byte, algorithm *checksum) bool {
+	if len(checksum) != algorithm.size {
+		return false
+	}
+	return bytes.Equal(algorithm.sum(data), checksum)
+}
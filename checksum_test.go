@@ -0,0 +1,241 @@
+package protocol
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestChecksumAlgorithms(t *testing.T) {
+	type point struct{ X, Y int }
+	args := map[string]any{
+		"point":  point{1, 2},
+		"values": []any{"moin", 1},
+		"tags":   map[string]string{"a": "b"},
+	}
+
+	tests := []struct {
+		name      string
+		algorithm byte
+		size      int
+	}{
+		{"crc32", ChecksumCRC32, 4},
+		{"crc32c", ChecksumCRC32C, 4},
+		{"crc64", ChecksumCRC64, 8},
+		{"sha256", ChecksumSHA256, 32},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := Options(ChecksumAlgorithm(tt.algorithm))
+			data, err := EncodeFunctionCall("call", options, args)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if data[checksumOffset] != tt.algorithm {
+				t.Fatalf("expected checksum byte %d, got %d", tt.algorithm, data[checksumOffset])
+			}
+
+			algorithm, err := checksumByID(tt.algorithm)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if algorithm.size != tt.size {
+				t.Fatalf("expected checksum of %d bytes, got %d", tt.size, algorithm.size)
+			}
+			if !bytes.Equal(data[len(data)-tt.size:], algorithm.sum(data[:len(data)-tt.size])) {
+				t.Fatalf("expected message to end with its checksum")
+			}
+
+			buf := bytes.NewBuffer(nil)
+			err = encodeArgumentWithOptions(buf, "moin", "s", options)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if expected := 1 + len("s") + 1 + 1 + 1 + len("moin") + tt.size; buf.Len() != expected {
+				t.Fatalf("expected argument of %d bytes, got %d", expected, buf.Len())
+			}
+
+			_, decoded, err := DecodeFunctionCall(data, Options())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var p point
+			err = decoded["point"].DecodeInto(&p)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if p != args["point"] {
+				t.Fatalf("expected %v, got %v", args["point"], p)
+			}
+			if !reflect.DeepEqual(decoded["tags"].Value, args["tags"]) {
+				t.Fatalf("expected %v, got %v", args["tags"], decoded["tags"].Value)
+			}
+
+			var target struct {
+				Point  point             `protocol:"point"`
+				Values []any             `protocol:"values"`
+				Tags   map[string]string `protocol:"tags"`
+			}
+			_, err = DecodeFunctionCallInto(data, Options(), &target)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			stream := bytes.NewBuffer(nil)
+			err = NewEncoder(stream, options).Encode("call", args)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			_, _, err = NewDecoder(stream, Options()).Decode()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			corrupted := bytes.Clone(data)
+			corrupted[len(corrupted)-tt.size-1] ^= 0xFF
+			_, _, err = DecodeFunctionCall(corrupted, Options())
+			if !errors.Is(err, ErrChecksumMismatch) {
+				t.Fatalf("expected checksum mismatch, got %v", err)
+			}
+		})
+	}
+}
+
+func TestUnknownChecksumAlgorithm(t *testing.T) {
+	_, err := EncodeFunctionCall("call", Options(ChecksumAlgorithm(0x7F)), map[string]any{"a": 1})
+	var unknown *UnknownChecksumError
+	if !errors.As(err, &unknown) || unknown.ID != 0x7F {
+		t.Fatalf("expected unknown checksum error, got %v", err)
+	}
+
+	data, err := EncodeFunctionCall("call", Options(), map[string]any{"a": 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data[checksumOffset] = 0x7F
+	_, _, err = DecodeFunctionCall(data, Options())
+	if !errors.As(err, &unknown) || unknown.ID != 0x7F {
+		t.Fatalf("expected unknown checksum error, got %v", err)
+	}
+}
+
+func TestArgumentChecksums(t *testing.T) {
+	type point struct{ X, Y int }
+	args := map[string]any{
+		"point":  point{1, 2},
+		"values": []any{"moin", 1},
+		"tags":   map[string]string{"a": "b"},
+	}
+
+	all, err := EncodeFunctionCall("call", Options(), args)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		mode      byte
+		algorithm byte
+	}{
+		{"all", ArgumentChecksumsAll, ChecksumCRC32},
+		{"top level", ArgumentChecksumsTopLevel, ChecksumCRC32},
+		{"none", ArgumentChecksumsNone, ChecksumCRC32},
+		{"top level sha256", ArgumentChecksumsTopLevel, ChecksumSHA256},
+		{"none sha256", ArgumentChecksumsNone, ChecksumSHA256},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := Options(ArgumentChecksums(tt.mode), ChecksumAlgorithm(tt.algorithm))
+			data, err := EncodeFunctionCall("call", options, args)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if mode := (data[flagsOffset] & flagArgumentChecksums) >> flagArgumentChecksumsShift; mode != tt.mode {
+				t.Fatalf("expected argument checksum mode %d, got %d", tt.mode, mode)
+			}
+			if tt.mode != ArgumentChecksumsAll && tt.algorithm == ChecksumCRC32 && len(data) >= len(all) {
+				t.Fatalf("expected message smaller than %d bytes, got %d", len(all), len(data))
+			}
+
+			_, decoded, err := DecodeFunctionCall(data, Options())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var p point
+			err = decoded["point"].DecodeInto(&p)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if p != args["point"] {
+				t.Fatalf("expected %v, got %v", args["point"], p)
+			}
+			if !reflect.DeepEqual(decoded["values"].Value, args["values"]) {
+				t.Fatalf("expected %v, got %v", args["values"], decoded["values"].Value)
+			}
+
+			var target struct {
+				Point  point             `protocol:"point"`
+				Values []any             `protocol:"values"`
+				Tags   map[string]string `protocol:"tags"`
+			}
+			_, err = DecodeFunctionCallInto(data, Options(), &target)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(target.Tags, args["tags"]) {
+				t.Fatalf("expected %v, got %v", args["tags"], target.Tags)
+			}
+		})
+	}
+}
+
+func TestArgumentChecksumsServer(t *testing.T) {
+	options := Options(ArgumentChecksums(ArgumentChecksumsNone))
+	server := NewServer(options)
+	_ = server.Register("sum", func(values []int) int {
+		total := 0
+		for _, value := range values {
+			total += value
+		}
+		return total
+	}, "values")
+
+	call, err := EncodeFunctionCall("sum", options, map[string]any{"values": []int{1, 2, 3}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	response, err := server.Handle(context.Background(), call)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, results, err := DecodeFunctionResult(response, Options())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if results["0"].Value != 6 {
+		t.Fatalf("expected 6, got %v", results["0"].Value)
+	}
+}
+
+func TestUnknownArgumentChecksums(t *testing.T) {
+	_, err := EncodeFunctionCall("call", Options(ArgumentChecksums(3)), map[string]any{"a": 1})
+	var encodingErr *EncodingError
+	if !errors.As(err, &encodingErr) {
+		t.Fatalf("expected EncodingError, got %v", err)
+	}
+
+	data, err := EncodeFunctionCall("call", Options(), map[string]any{"a": 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data[flagsOffset] |= flagArgumentChecksums
+	_, _, err = DecodeFunctionCall(data, Options())
+	var decodingErr *DecodingError
+	if !errors.As(err, &decodingErr) || decodingErr.Offset != flagsOffset {
+		t.Fatalf("expected DecodingError at the flags, got %v", err)
+	}
+}
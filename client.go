@@ -0,0 +1,153 @@
+package protocol
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+type response struct {
+	message *Message
+	err     error
+}
+
+type Client struct {
+	conn    io.ReadWriteCloser
+	options *options
+	encoder *Encoder
+	decoder *Decoder
+
+	nextID  atomic.Uint64
+	mu      sync.Mutex
+	pending map[uint64]chan response
+	err     error
+	done    chan struct{}
+}
+
+func NewClient(conn io.ReadWriteCloser, options *options) *Client {
+	c := &Client{
+		conn:    conn,
+		options: options,
+		encoder: NewEncoder(conn, options),
+		decoder: NewDecoder(conn, options),
+		pending: make(map[uint64]chan response),
+		done:    make(chan struct{}),
+	}
+	go c.readLoop()
+	return c
+}
+
+func (c *Client) Call(ctx context.Context, name string, args map[string]any) (map[string]Argument, error) {
+	err := ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	id := c.nextID.Add(1)
+	data, err := EncodeFunctionCall(name, c.options.with(RequestID(id)), args)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make(chan response, 1)
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, c.err
+	}
+	c.pending[id] = responses
+	c.mu.Unlock()
+
+	err = c.encoder.WriteMessage(data)
+	if err != nil {
+		c.forget(id)
+		return nil, err
+	}
+
+	select {
+	case response := <-responses:
+		if response.err != nil {
+			return nil, response.err
+		}
+		if response.message.Kind == KindError {
+			return nil, response.message.Err
+		}
+		return response.message.Arguments, nil
+	case <-ctx.Done():
+		c.forget(id)
+		return nil, ctx.Err()
+	case <-c.done:
+		return nil, c.Err()
+	}
+}
+
+func (c *Client) Close() error {
+	c.fail(ErrClientClosed)
+	return c.conn.Close()
+}
+
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *Client) forget(id uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pending, id)
+}
+
+func (c *Client) readLoop() {
+	for {
+		data, err := c.decoder.ReadMessage()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			c.fail(&ConnectionError{err: err})
+			_ = c.conn.Close()
+			return
+		}
+
+		message, err := DecodeMessage(data, c.options)
+		if message != nil {
+			if message.Kind != KindCall {
+				c.deliver(message.RequestID, response{message: message})
+			}
+			continue
+		}
+
+		kind, requestID, ok := readRequestID(data)
+		if !ok {
+			c.fail(&ConnectionError{err: err})
+			_ = c.conn.Close()
+			return
+		}
+		if kind != KindCall {
+			c.deliver(requestID, response{err: err})
+		}
+	}
+}
+
+func (c *Client) deliver(requestID uint64, r response) {
+	c.mu.Lock()
+	responses, ok := c.pending[requestID]
+	delete(c.pending, requestID)
+	c.mu.Unlock()
+	if ok {
+		responses <- r
+	}
+}
+
+func (c *Client) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	c.pending = nil
+	close(c.done)
+}
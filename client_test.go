@@ -0,0 +1,174 @@
+package protocol
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T, server *Server, opts ...Option) (*Client, net.Conn) {
+	clientConn, serverConn := net.Pipe()
+	go func() {
+		_ = server.ServeConn(context.Background(), serverConn)
+	}()
+
+	client := NewClient(clientConn, Options(opts...))
+	t.Cleanup(func() {
+		client.Close()
+		serverConn.Close()
+	})
+	return client, serverConn
+}
+
+func TestClientCall(t *testing.T) {
+	server := NewServer(Options())
+	_ = server.Register("add", func(a, b int) int { return a + b }, "a", "b")
+	_ = server.Register("sleep", func(ms int) int {
+		time.Sleep(time.Duration(ms) * time.Millisecond)
+		return ms
+	}, "ms")
+	client, _ := newTestClient(t, server)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			results, err := client.Call(context.Background(), "add", map[string]any{"a": i, "b": i})
+			if err != nil {
+				errs <- err
+				return
+			}
+			if results["0"].Value != 2*i {
+				errs <- fmt.Errorf("expected %d, got %v", 2*i, results["0"].Value)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			ms := 50 - i
+			results, err := client.Call(context.Background(), "sleep", map[string]any{"ms": ms})
+			if err != nil {
+				errs <- err
+				return
+			}
+			if results["0"].Value != ms {
+				errs <- fmt.Errorf("expected %d, got %v", ms, results["0"].Value)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestClientCallErrors(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	server := NewServer(Options())
+	_ = server.Register("fail", func() error { return &RemoteError{Code: 42, Message: "rejected"} })
+	_ = server.Register("block", func() { <-block })
+
+	t.Run("remote error", func(t *testing.T) {
+		client, _ := newTestClient(t, server)
+		_, err := client.Call(context.Background(), "fail", nil)
+		var remoteErr *RemoteError
+		if !errors.As(err, &remoteErr) || remoteErr.Code != 42 {
+			t.Fatalf("expected remote error, got %v", err)
+		}
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		client, _ := newTestClient(t, server)
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		_, err := client.Call(ctx, "block", nil)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected deadline exceeded, got %v", err)
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		client, _ := newTestClient(t, server)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := client.Call(ctx, "block", nil)
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected canceled, got %v", err)
+		}
+	})
+
+	t.Run("connection dropped", func(t *testing.T) {
+		client, serverConn := newTestClient(t, server)
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			serverConn.Close()
+		}()
+		_, err := client.Call(context.Background(), "block", nil)
+		var connErr *ConnectionError
+		if !errors.As(err, &connErr) {
+			t.Fatalf("expected connection error, got %v", err)
+		}
+		_, err = client.Call(context.Background(), "fail", nil)
+		if !errors.As(err, &connErr) {
+			t.Fatalf("expected connection error, got %v", err)
+		}
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		client, _ := newTestClient(t, server)
+		client.Close()
+		_, err := client.Call(context.Background(), "fail", nil)
+		if !errors.Is(err, ErrClientClosed) {
+			t.Fatalf("expected client closed, got %v", err)
+		}
+	})
+}
+
+func TestClientCallUndecodable(t *testing.T) {
+	t.Run("call", func(t *testing.T) {
+		server := NewServer(Options(MaxArguments(1)))
+		_ = server.Register("add", func(a, b int) int { return a + b }, "a", "b")
+		client, _ := newTestClient(t, server)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_, err := client.Call(ctx, "add", map[string]any{"a": 1, "b": 2})
+		var remoteErr *RemoteError
+		if !errors.As(err, &remoteErr) || remoteErr.Code != CodeInvalidArguments {
+			t.Fatalf("expected invalid arguments, got %v", err)
+		}
+		if !strings.Contains(remoteErr.Message, "arguments limit exceeded") {
+			t.Fatalf("expected limit error, got %q", remoteErr.Message)
+		}
+	})
+
+	t.Run("response", func(t *testing.T) {
+		server := NewServer(Options())
+		_ = server.Register("list", func(n int) []int { return make([]int, n) }, "n")
+		client, _ := newTestClient(t, server, MaxElements(2))
+
+		_, err := client.Call(context.Background(), "list", map[string]any{"n": 3})
+		var limitErr *LimitExceededError
+		if !errors.As(err, &limitErr) || limitErr.Limit != "elements" {
+			t.Fatalf("expected elements limit error, got %v", err)
+		}
+
+		results, err := client.Call(context.Background(), "list", map[string]any{"n": 2})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(results["0"].Value, []int{0, 0}) {
+			t.Fatalf("expected two elements, got %#v", results["0"].Value)
+		}
+	})
+}
@@ -0,0 +1,151 @@
+package protocol
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/lzw"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"sync"
+)
+
+const (
+	DefaultCompressionLevel     = flate.BestCompression
+	DefaultCompressionThreshold = 100
+)
+
+const (
+	CodecNone  byte = 0x00
+	CodecGzip  byte = 0x01
+	CodecZlib  byte = 0x02
+	CodecFlate byte = 0x03
+	CodecLZW   byte = 0x04
+)
+
+type Codec interface {
+	NewWriter(w io.Writer, level int) (io.WriteCloser, error)
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[byte]Codec{
+		CodecGzip:  gzipCodec{},
+		CodecZlib:  zlibCodec{},
+		CodecFlate: flateCodec{},
+		CodecLZW:   lzwCodec{},
+	}
+)
+
+func RegisterCodec(id byte, codec Codec) error {
+	if id == CodecNone {
+		return fmt.Errorf("codec id %d is reserved for uncompressed messages", id)
+	}
+	if codec == nil {
+		return fmt.Errorf("codec %d must not be nil", id)
+	}
+
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	if _, ok := codecs[id]; ok {
+		return fmt.Errorf("codec %d is already registered", id)
+	}
+	codecs[id] = codec
+	return nil
+}
+
+func codecByID(id byte) (Codec, error) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	codec, ok := codecs[id]
+	if !ok {
+		return nil, &UnknownCodecError{ID: id}
+	}
+	return codec, nil
+}
+
+type gzipCodec struct{}
+
+func (gzipCodec) NewWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	return gzip.NewWriterLevel(w, level)
+}
+
+func (gzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+type zlibCodec struct{}
+
+func (zlibCodec) NewWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	return zlib.NewWriterLevel(w, level)
+}
+
+func (zlibCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return zlib.NewReader(r)
+}
+
+type flateCodec struct{}
+
+func (flateCodec) NewWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	return flate.NewWriter(w, level)
+}
+
+func (flateCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return flate.NewReader(r), nil
+}
+
+type lzwCodec struct{}
+
+func (lzwCodec) NewWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	return lzw.NewWriter(w, lzw.MSB, 8), nil
+}
+
+func (lzwCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return lzw.NewReader(r, lzw.MSB, 8), nil
+}
+
+func compressArguments(data []byte, options *options) ([]byte, byte, error) {
+	codecID := options.codecOrDefault()
+	if codecID == CodecNone || options.autoCompression && len(data) <= options.compressionThresholdOrDefault() {
+		return data, CodecNone, nil
+	}
+
+	codec, err := codecByID(codecID)
+	if err != nil {
+		return nil, codecID, err
+	}
+	compressed, err := compressBuffer(bytes.NewBuffer(data), codec, options.compressionLevelOrDefault())
+	if err != nil {
+		return nil, codecID, err
+	}
+	if options.autoCompression && len(compressed) >= len(data) {
+		return data, CodecNone, nil
+	}
+	return compressed, codecID, nil
+}
+
+func (o *options) codecOrDefault() byte {
+	if !o.compression {
+		return CodecNone
+	}
+	if o.codec == CodecNone {
+		return CodecGzip
+	}
+	return o.codec
+}
+
+func (o *options) compressionThresholdOrDefault() int {
+	if o.compressionThreshold <= 0 {
+		return DefaultCompressionThreshold
+	}
+	return o.compressionThreshold
+}
+
+func (o *options) compressionLevelOrDefault() int {
+	if !o.compressionLevelSet {
+		return DefaultCompressionLevel
+	}
+	return o.compressionLevel
+}
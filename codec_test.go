@@ -0,0 +1,176 @@
+package protocol
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type reverseCodec struct{}
+
+func (reverseCodec) NewWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	return &reverseWriter{w: w}, nil
+}
+
+func (reverseCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(reversed(data))), nil
+}
+
+type reverseWriter struct {
+	w   io.Writer
+	buf bytes.Buffer
+}
+
+func (w *reverseWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *reverseWriter) Close() error {
+	_, err := w.w.Write(reversed(w.buf.Bytes()))
+	return err
+}
+
+func reversed(data []byte) []byte {
+	result := make([]byte, len(data))
+	for i, b := range data {
+		result[len(data)-1-i] = b
+	}
+	return result
+}
+
+func TestCodecs(t *testing.T) {
+	err := RegisterCodec(0x80, reverseCodec{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	args := map[string]any{"s": "moin moin moin moin", "n": []int{1, 2, 3}}
+
+	tests := []struct {
+		name  string
+		codec byte
+	}{
+		{"none", CodecNone},
+		{"gzip", CodecGzip},
+		{"zlib", CodecZlib},
+		{"flate", CodecFlate},
+		{"lzw", CodecLZW},
+		{"registered", 0x80},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := Options(CompressionCodec(tt.codec))
+			data, err := EncodeFunctionCall("call", options, args)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if data[10] != tt.codec {
+				t.Fatalf("expected codec byte %d, got %d", tt.codec, data[10])
+			}
+
+			_, decoded, err := DecodeFunctionCall(data, Options())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if decoded["s"].Value != args["s"] {
+				t.Fatalf("expected %q, got %v", args["s"], decoded["s"].Value)
+			}
+		})
+	}
+}
+
+func TestCodecErrors(t *testing.T) {
+	if err := RegisterCodec(CodecNone, reverseCodec{}); err == nil {
+		t.Fatalf("expected error registering codec 0")
+	}
+	if err := RegisterCodec(CodecGzip, reverseCodec{}); err == nil {
+		t.Fatalf("expected error registering an existing codec")
+	}
+	if err := RegisterCodec(0x81, nil); err == nil {
+		t.Fatalf("expected error registering a nil codec")
+	}
+
+	_, err := EncodeFunctionCall("call", Options(CompressionCodec(0x7F)), map[string]any{"a": 1})
+	var unknown *UnknownCodecError
+	if !errors.As(err, &unknown) || unknown.ID != 0x7F {
+		t.Fatalf("expected unknown codec error, got %v", err)
+	}
+
+	data, err := EncodeFunctionCall("call", Options(), map[string]any{"a": 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data[10] = 0x7F
+	_, _, err = DecodeFunctionCall(withFixedChecksum(data), Options())
+	if !errors.As(err, &unknown) || unknown.ID != 0x7F {
+		t.Fatalf("expected unknown codec error, got %v", err)
+	}
+	var decodingErr *DecodingError
+	if !errors.As(err, &decodingErr) || decodingErr.Offset != 10 {
+		t.Fatalf("expected decoding error at offset 10, got %v", err)
+	}
+}
+
+func TestAutoCompression(t *testing.T) {
+	random := make([]byte, 512)
+	for i := range random {
+		random[i] = byte(rand.Intn(256))
+	}
+	repeated := strings.Repeat("moin ", 100)
+
+	tests := []struct {
+		name     string
+		options  []Option
+		args     map[string]any
+		expected byte
+	}{
+		{"below threshold", []Option{AutoCompression(0)}, map[string]any{"s": "moin"}, CodecNone},
+		{"above threshold", []Option{AutoCompression(0)}, map[string]any{"s": repeated}, CodecGzip},
+		{"custom threshold", []Option{AutoCompression(1024)}, map[string]any{"s": repeated}, CodecNone},
+		{"incompressible", []Option{AutoCompression(0)}, map[string]any{"b": random}, CodecNone},
+		{"codec", []Option{AutoCompression(0), CompressionCodec(CodecZlib)}, map[string]any{"s": repeated}, CodecZlib},
+		{"level", []Option{AutoCompression(0), CompressionLevel(flate.BestSpeed)}, map[string]any{"s": repeated}, CodecGzip},
+		{"no compression level", []Option{AutoCompression(0), CompressionLevel(flate.NoCompression)}, map[string]any{"s": repeated}, CodecNone},
+		{"unconditional", []Option{Compression(true)}, map[string]any{"s": "moin"}, CodecGzip},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := EncodeFunctionCall("call", Options(tt.options...), tt.args)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if data[codecOffset] != tt.expected {
+				t.Fatalf("expected codec byte %d, got %d", tt.expected, data[codecOffset])
+			}
+
+			uncompressed, err := EncodeFunctionCall("call", Options(), tt.args)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if Options(tt.options...).autoCompression && tt.expected != CodecNone && len(data) >= len(uncompressed) {
+				t.Fatalf("expected compressed message to be smaller than %d bytes, got %d", len(uncompressed), len(data))
+			}
+
+			_, args, err := DecodeFunctionCall(data, Options())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for key, value := range tt.args {
+				if !reflect.DeepEqual(args[key].Value, value) {
+					t.Fatalf("expected %v, got %v", value, args[key].Value)
+				}
+			}
+		})
+	}
+}
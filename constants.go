@@ -1,10 +1,24 @@
 package protocol
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
 )
 
+var (
+	ErrClientClosed     = errors.New("client closed")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrInvalidVersion   = errors.New("invalid version")
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	ErrTruncated        = errors.New("truncated data")
+
+	ErrUnauthenticated   = errors.New("message is not authenticated")
+	ErrNoKeyProvider     = errors.New("no key provider configured")
+	ErrUnknownKey        = errors.New("unknown key")
+	ErrSignatureMismatch = errors.New("signature mismatch")
+)
+
 type UnsupportedTypeError struct {
 	Kind reflect.Kind
 }
@@ -14,19 +28,93 @@ func (e *UnsupportedTypeError) Error() string {
 }
 
 type EncodingError struct {
-	err error
+	Path   string
+	Offset int
+	err    error
 }
 
 func (e *EncodingError) Error() string {
-	return fmt.Sprintf("error while encoding: %v", e.err)
+	if e.Path == "" {
+		return fmt.Sprintf("error while encoding at offset %d: %v", e.Offset, e.err)
+	}
+	return fmt.Sprintf("error while encoding %q at offset %d: %v", e.Path, e.Offset, e.err)
+}
+
+func (e *EncodingError) Unwrap() error {
+	return e.err
 }
 
 type DecodingError struct {
-	err error
+	Path   string
+	Offset int
+	err    error
 }
 
 func (e *DecodingError) Error() string {
-	return fmt.Sprintf("error while decoding: %v", e.err)
+	if e.Path == "" {
+		return fmt.Sprintf("error while decoding at offset %d: %v", e.Offset, e.err)
+	}
+	return fmt.Sprintf("error while decoding %q at offset %d: %v", e.Path, e.Offset, e.err)
+}
+
+func (e *DecodingError) Unwrap() error {
+	return e.err
+}
+
+type MessageTooLargeError struct {
+	Size  int
+	Limit int
+}
+
+func (e *MessageTooLargeError) Error() string {
+	return fmt.Sprintf("message of %d bytes exceeds the limit of %d bytes", e.Size, e.Limit)
+}
+
+type LimitExceededError struct {
+	Limit string
+	Path  string
+	Value int
+	Max   int
+}
+
+func (e *LimitExceededError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("%s limit exceeded: %d > %d", e.Limit, e.Value, e.Max)
+	}
+	return fmt.Sprintf("%s limit exceeded at %q: %d > %d", e.Limit, e.Path, e.Value, e.Max)
+}
+
+type UnknownCodecError struct {
+	ID byte
+}
+
+func (e *UnknownCodecError) Error() string {
+	return fmt.Sprintf("unknown compression codec %d", e.ID)
+}
+
+type AuthenticationError struct {
+	Mode  byte
+	KeyID string
+	err   error
+}
+
+func (e *AuthenticationError) Error() string {
+	if e.Mode == AuthNone {
+		return fmt.Sprintf("authentication failed: %v", e.err)
+	}
+	return fmt.Sprintf("authentication failed for key %q: %v", e.KeyID, e.err)
+}
+
+func (e *AuthenticationError) Unwrap() error {
+	return e.err
+}
+
+type UnknownChecksumError struct {
+	ID byte
+}
+
+func (e *UnknownChecksumError) Error() string {
+	return fmt.Sprintf("unknown checksum algorithm %d", e.ID)
 }
 
 type NonMatchingSubversionError struct {
@@ -38,6 +126,133 @@ func (e *NonMatchingSubversionError) Error() string {
 	return fmt.Sprintf("subversion mismatch: expected %v, got %v", e.Expected, e.Actual)
 }
 
+type UnexportedFieldError struct {
+	Type  reflect.Type
+	Field string
+}
+
+func (e *UnexportedFieldError) Error() string {
+	return fmt.Sprintf("unexported field %s in %v", e.Field, e.Type)
+}
+
+type TypeMismatchError struct {
+	Path   string
+	Typ    byte
+	Target reflect.Type
+}
+
+func (e *TypeMismatchError) Error() string {
+	return fmt.Sprintf("cannot decode %s into %v at %q", TypeToString[e.Typ], e.Target, e.Path)
+}
+
+type OverflowError struct {
+	Path   string
+	Value  any
+	Target reflect.Type
+}
+
+func (e *OverflowError) Error() string {
+	return fmt.Sprintf("value %v overflows %v at %q", e.Value, e.Target, e.Path)
+}
+
+type InvalidTargetError struct {
+	Type reflect.Type
+}
+
+func (e *InvalidTargetError) Error() string {
+	if e.Type == nil {
+		return "invalid decoding target: nil"
+	}
+	if e.Type.Kind() != reflect.Ptr {
+		return fmt.Sprintf("invalid decoding target: non-pointer %v", e.Type)
+	}
+	return fmt.Sprintf("invalid decoding target: nil %v", e.Type)
+}
+
+type UnknownFunctionError struct {
+	Name string
+}
+
+func (e *UnknownFunctionError) Error() string {
+	return fmt.Sprintf("unknown function %q", e.Name)
+}
+
+type MissingArgumentError struct {
+	Function string
+	Argument string
+}
+
+func (e *MissingArgumentError) Error() string {
+	return fmt.Sprintf("missing argument %q for function %q", e.Argument, e.Function)
+}
+
+type UnexpectedArgumentError struct {
+	Function string
+	Argument string
+}
+
+func (e *UnexpectedArgumentError) Error() string {
+	return fmt.Sprintf("unexpected argument %q for function %q", e.Argument, e.Function)
+}
+
+type ConnectionError struct {
+	err error
+}
+
+func (e *ConnectionError) Error() string {
+	return fmt.Sprintf("connection lost: %v", e.err)
+}
+
+func (e *ConnectionError) Unwrap() error {
+	return e.err
+}
+
+type UnexpectedMessageKindError struct {
+	Expected MessageKind
+	Actual   MessageKind
+}
+
+func (e *UnexpectedMessageKindError) Error() string {
+	return fmt.Sprintf("unexpected message kind: expected %v, got %v", e.Expected, e.Actual)
+}
+
+type RemoteError struct {
+	Code    int
+	Message string
+	Details map[string]any
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("remote error %d: %s", e.Code, e.Message)
+}
+
+const (
+	CodeApplication int = iota + 1
+	CodeUnknownFunction
+	CodeInvalidArguments
+	CodeInternal
+)
+
+type MessageKind byte
+
+const (
+	KindCall MessageKind = iota
+	KindResult
+	KindError
+)
+
+func (k MessageKind) String() string {
+	switch k {
+	case KindCall:
+		return "call"
+	case KindResult:
+		return "result"
+	case KindError:
+		return "error"
+	}
+	return fmt.Sprintf("MessageKind(%d)", byte(k))
+}
+
 var signature = []byte{0x69, 0xDE, 0xDE, 0x69, 0xF0, 0x9F, 0x90, 0xBB}
 
 func Signature() []byte {
@@ -68,6 +283,14 @@ const (
 	TypeSlice
 	TypeMap
 	TypeMapStringKey
+
+	TypeNil
+	TypeBytes
+
+	TypeTime
+	TypeDuration
+
+	TypePackedSlice
 )
 
 var simpleTypeTagMappings = map[reflect.Kind]byte{
@@ -94,15 +317,59 @@ var simpleTypeTagMappings = map[reflect.Kind]byte{
 }
 
 func AnyToTypeTag(value any) (byte, bool) {
-	kind := reflect.TypeOf(value).Kind()
-	simple, ok := simpleTypeTagMappings[kind]
+	if value == nil {
+		return TypeNil, true
+	}
+
+	reflectValue := reflect.ValueOf(value)
+	if reflectValue.Kind() == reflect.Ptr {
+		if isRecursivePointer(reflectValue.Type()) {
+			return 0x00, false
+		}
+		if reflectValue.IsNil() {
+			return TypeNil, true
+		}
+		return AnyToTypeTag(reflectValue.Elem().Interface())
+	}
+
+	switch reflectValue.Kind() {
+	case reflect.Map, reflect.Slice:
+		if _, ok := marshalerTypeTag(reflectValue.Type()); !ok && reflectValue.IsNil() {
+			return TypeNil, true
+		}
+	}
+
+	return TypeToTypeTag(reflectValue.Type())
+}
+
+func TypeToTypeTag(t reflect.Type) (byte, bool) {
+	if t.Kind() == reflect.Ptr {
+		if isRecursivePointer(t) {
+			return 0x00, false
+		}
+		return TypeToTypeTag(t.Elem())
+	}
+	if builtin, ok := builtinTypeTags[t]; ok {
+		return builtin, true
+	}
+	if marshaled, ok := marshalerTypeTag(t); ok {
+		return marshaled, true
+	}
+
+	if isByteSequence(t) {
+		return TypeBytes, true
+	}
+	if _, ok := packedElementTypeTag(t); ok {
+		return TypePackedSlice, true
+	}
+
+	simple, ok := simpleTypeTagMappings[t.Kind()]
 	if !ok {
 		return 0x00, false
 	}
 
 	if simple == TypeMap {
-		mapValue := reflect.ValueOf(value)
-		if mapValue.Type().Key().Kind() == reflect.String {
+		if t.Key().Kind() == reflect.String {
 			return TypeMapStringKey, true
 		}
 	}
@@ -130,6 +397,29 @@ var TypeToString = map[byte]string{
 	TypeSlice:        "slice",
 	TypeMap:          "map",
 	TypeMapStringKey: "map[string]",
+	TypeNil:          "nil",
+	TypeBytes:        "bytes",
+	TypeTime:         "time",
+	TypeDuration:     "duration",
+	TypePackedSlice:  "packed slice",
+}
+
+// isRecursivePointer reports whether following t's pointer elements leads
+// back to a type already seen, as with type P *P, which would never end.
+func isRecursivePointer(t reflect.Type) bool {
+	seen := map[reflect.Type]bool{}
+	for t.Kind() == reflect.Ptr {
+		if seen[t] {
+			return true
+		}
+		seen[t] = true
+		t = t.Elem()
+	}
+	return false
+}
+
+func isByteSequence(t reflect.Type) bool {
+	return (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem().Kind() == reflect.Uint8
 }
 
 func isFixedType(typeTag byte) bool {
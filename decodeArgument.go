@@ -3,17 +3,45 @@ package protocol
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
-	"hash/crc32"
 	"reflect"
+	"time"
 )
 
 func decodeArgument(data []byte) (name string, value any, typ byte, err error) {
-	withoutChecksum := data[:len(data)-4]
-	checksum := data[len(data)-4:]
-	ok := verifyChecksum(withoutChecksum, checksum)
+	return decodeArgumentWithState(data, newDecodeState(Options()))
+}
+
+func decodeArgumentWithState(data []byte, state decodeState) (name string, value any, typ byte, err error) {
+	name, typ, content, err := readArgument(data, state)
+	if err != nil {
+		return
+	}
+
+	argState, err := state.field(name)
+	if err != nil {
+		return
+	}
+	value, err = decodeContentWithState(typ, content, argState.content(data, content))
+	return
+}
+
+func readArgument(data []byte, state decodeState) (name string, typ byte, content []byte, err error) {
+	defer func() {
+		err = state.wrap(err)
+	}()
+
+	size := state.checksum.size
+	if len(data) < size {
+		err = fmt.Errorf("%w: argument of %d bytes is too short for its checksum", ErrTruncated, len(data))
+		return
+	}
+	withoutChecksum := data[:len(data)-size]
+	checksum := data[len(data)-size:]
+	ok := verifyChecksum(withoutChecksum, checksum, state.checksum)
 	if !ok {
-		err = fmt.Errorf("Arguments checksum verification failed")
+		err = fmt.Errorf("argument %w", ErrChecksumMismatch)
 		return
 	}
 
@@ -21,217 +49,406 @@ func decodeArgument(data []byte) (name string, value any, typ byte, err error) {
 
 	typ, err = buffer.ReadByte()
 	if err != nil {
+		err = fmt.Errorf("%w: argument without type", ErrTruncated)
 		return
 	}
 
-	name, err = readIdentifier(buffer)
+	name, err = readIdentifier(buffer, state)
 	if err != nil {
 		return
 	}
 
 	contentSizeDescriptor, err := buffer.ReadByte()
 	if err != nil {
+		err = fmt.Errorf("%w: argument %q without size descriptor", ErrTruncated, name)
 		return
 	}
 	sizeBytes := buffer.Next(int(contentSizeDescriptor))
-	var size int
+	if len(sizeBytes) != int(contentSizeDescriptor) {
+		err = fmt.Errorf("%w: argument %q without size", ErrTruncated, name)
+		return
+	}
+	size, err = readSize(sizeBytes)
+	if err != nil {
+		return
+	}
+	if size > buffer.Len() {
+		err = fmt.Errorf("%w: argument %q declares %d bytes of content but carries %d", ErrTruncated, name, size, buffer.Len())
+		return
+	}
+	if size != buffer.Len() {
+		err = fmt.Errorf("argument %q declares %d bytes of content but carries %d", name, size, buffer.Len())
+		return
+	}
+
+	content = buffer.Next(size)
+	return
+}
+
+func readSize(sizeBytes []byte) (int, error) {
+	var size int64
 	switch len(sizeBytes) {
 	case 1:
-		size = int(int8(sizeBytes[0]))
+		size = int64(int8(sizeBytes[0]))
 	case 2:
-		size = int(int16(binary.BigEndian.Uint16(sizeBytes)))
+		size = int64(int16(binary.BigEndian.Uint16(sizeBytes)))
 	case 4:
-		size = int(int32(binary.BigEndian.Uint32(sizeBytes)))
+		size = int64(int32(binary.BigEndian.Uint32(sizeBytes)))
 	case 8:
-		size = int(int64(binary.BigEndian.Uint64(sizeBytes)))
+		size = int64(binary.BigEndian.Uint64(sizeBytes))
 	default:
-		err = fmt.Errorf("Invalid size descriptor: %v", sizeBytes)
+		return 0, fmt.Errorf("invalid size descriptor: %v", sizeBytes)
+	}
+	if size < 0 {
+		return 0, fmt.Errorf("negative content size: %d", size)
 	}
+	return int(size), nil
+}
+
+func decodeContent(typ byte, content []byte) (any, error) {
+	return decodeContentWithState(typ, content, newDecodeState(Options()))
+}
 
-	content := buffer.Next(size)
+func decodeContentWithState(typ byte, content []byte, state decodeState) (value any, err error) {
+	defer func() {
+		err = state.wrap(err)
+	}()
+	state = state.nested()
 
 	if isFixedType(typ) {
-		value, err = decodeFixedPrimitiveContent(typ, content)
+		if len(content) != int(packedElementTypes[typ].Size()) {
+			return nil, fmt.Errorf("invalid %s content length: %d", TypeToString[typ], len(content))
+		}
+		return decodeFixedPrimitiveContent(typ, content)
+	}
+
+	switch typ {
+	case TypeInt, TypeUInt:
+		if len(content) != 8 {
+			return nil, fmt.Errorf("invalid %s content length: %d", TypeToString[typ], len(content))
+		}
+	}
+
+	switch typ {
+	case TypeInt:
+		var result int64
+		reader := bytes.NewReader(content)
+		err = binary.Read(reader, binary.BigEndian, &result)
 		if err != nil {
 			return
 		}
-	} else {
-		switch typ {
-		case TypeInt:
-			var result int64
-			reader := bytes.NewReader(content)
-			err = binary.Read(reader, binary.BigEndian, &result)
-			if err != nil {
-				return
-			}
-			value = int(result)
-		case TypeUInt:
-			var result uint64
-			reader := bytes.NewReader(content)
-			err = binary.Read(reader, binary.BigEndian, &result)
+		value = int(result)
+	case TypeUInt:
+		var result uint64
+		reader := bytes.NewReader(content)
+		err = binary.Read(reader, binary.BigEndian, &result)
+		if err != nil {
+			return
+		}
+		value = uint(result)
+	case TypeString:
+		value = string(content)
+	case TypeNil:
+		value = nil
+	case TypeBytes:
+		value = bytes.Clone(content)
+	case TypePackedSlice:
+		slice, err := decodePackedSlice(content, state)
+		if err != nil {
+			return nil, err
+		}
+		value = slice.Interface()
+	case TypeTime:
+		value, err = decodeTime(content)
+	case TypeDuration:
+		if len(content) != 8 {
+			return nil, fmt.Errorf("invalid duration content length: %d", len(content))
+		}
+		value = time.Duration(binary.BigEndian.Uint64(content))
+	case TypeStruct:
+		splitData, err := splitArgumentList(content, state, "elements", state.options.maxElementsOrDefault(), 1)
+		if err != nil {
+			return nil, err
+		}
+		structField := make([]reflect.StructField, 0, len(splitData))
+		fieldValues := make([]any, 0, len(splitData))
+		goNames := make(map[string]bool)
+		offset := state.offset
+		for i, fieldData := range splitData {
+			name, fieldValue, _, err := decodeArgumentWithState(fieldData, state.at(offset))
 			if err != nil {
-				return
+				return nil, err
 			}
-			value = uint(result)
-		case TypeString:
-			value = string(content)
-		case TypeStruct:
-			var structField []reflect.StructField
-			splitData, err := splitArgumentListData(content)
-			if err != nil {
-				return "", nil, 0, err
+			offset += len(fieldData)
+			fieldType := reflect.TypeOf(fieldValue)
+			if fieldType == nil {
+				fieldType = reflect.TypeOf((*any)(nil)).Elem()
 			}
-			dataForSetting := make(map[string]any)
-			for _, fieldData := range splitData {
-				name, fieldValue, _, err := decodeArgument(fieldData)
-				if err != nil {
-					return "", nil, 0, err
-				}
-				dataForSetting[name] = fieldValue
-				structField = append(structField, reflect.StructField{Name: name, Type: reflect.TypeOf(fieldValue)})
+			field := structOfField(name, fieldType)
+			goName := field.Name
+			for suffix := i; goNames[field.Name]; suffix++ {
+				field.Name = fmt.Sprintf("%s%d", goName, suffix)
 			}
-			structType := reflect.StructOf(structField)
-			instance := reflect.New(structType).Elem()
-			for name, fieldValue := range dataForSetting {
-				field := instance.FieldByName(name)
-				if field.IsValid() && field.CanSet() {
-					field.Set(reflect.ValueOf(fieldValue))
-				}
+			goNames[field.Name] = true
+			structField = append(structField, field)
+			fieldValues = append(fieldValues, fieldValue)
+		}
+		structType := reflect.StructOf(structField)
+		instance := reflect.New(structType).Elem()
+		for i, fieldValue := range fieldValues {
+			if fieldValue != nil {
+				instance.Field(i).Set(reflect.ValueOf(fieldValue))
 			}
-			value = instance.Interface()
-		case TypeSlice:
-			splitData, err := splitArgumentListData(content)
+		}
+		value = instance.Interface()
+	case TypeSlice:
+		splitData, err := splitArgumentList(content, state, "elements", state.options.maxElementsOrDefault(), 1)
+		if err != nil {
+			return nil, err
+		}
+		tmp := make([]any, 0, len(splitData))
+		offset := state.offset
+		for i, fieldData := range splitData {
+			fieldValue, err := decodeElement(fieldData, state.at(offset), fmt.Sprintf("%s[%d]", state.path, i))
 			if err != nil {
-				return "", nil, 0, err
-			}
-			tmp := make([]any, 0)
-			typesInSlice := make([]reflect.Type, 0)
-			for _, fieldData := range splitData {
-				_, fieldValue, _, err := decodeArgument(fieldData)
-				if err != nil {
-					return "", nil, 0, err
-				}
-				typesInSlice = append(typesInSlice, reflect.TypeOf(fieldValue))
-				tmp = append(tmp, fieldValue)
-			}
-			if len(tmp) == 0 {
-				value = tmp
-				break
+				return nil, err
 			}
-			isAllSameType := true
-			sameType := typesInSlice[0]
-			for _, t := range typesInSlice {
-				if t != sameType {
-					isAllSameType = false
-					break
-				}
+			offset += len(fieldData)
+			tmp = append(tmp, fieldValue)
+		}
+		sameType := uniformType(tmp)
+		if sameType == nil {
+			value = tmp
+			break
+		}
+		slice := reflect.MakeSlice(reflect.SliceOf(sameType), len(tmp), len(tmp))
+		for i, v := range tmp {
+			slice.Index(i).Set(reflect.ValueOf(v))
+		}
+		value = slice.Interface()
+	case TypeMapStringKey:
+		splitData, err := splitArgumentList(content, state, "elements", state.options.maxElementsOrDefault(), 1)
+		if err != nil {
+			return nil, err
+		}
+		keys := make([]string, 0, len(splitData))
+		values := make([]any, 0, len(splitData))
+		offset := state.offset
+		for _, fieldData := range splitData {
+			name, typ, content, err := readArgument(fieldData, state.at(offset))
+			if err != nil {
+				return nil, err
 			}
-			if isAllSameType {
-				slice := reflect.MakeSlice(reflect.SliceOf(sameType), len(tmp), len(tmp))
-				for i, v := range tmp {
-					slice.Index(i).Set(reflect.ValueOf(v))
-				}
-				value = slice.Interface()
-			} else {
-				value = tmp
+			elementState, err := state.at(offset).child(fmt.Sprintf("%s[%q]", state.path, name))
+			if err != nil {
+				return nil, err
 			}
-		case TypeMapStringKey:
-			splitData, err := splitArgumentListData(content)
+			fieldValue, err := decodeContentWithState(typ, content, elementState.content(fieldData, content))
 			if err != nil {
-				return "", nil, 0, err
+				return nil, err
 			}
-			tmp := make(map[string]any)
-			for _, fieldData := range splitData {
-				name, fieldValue, _, err := decodeArgument(fieldData)
-				if err != nil {
-					return "", nil, 0, err
-				}
-				tmp[name] = fieldValue
+			offset += len(fieldData)
+			keys = append(keys, name)
+			values = append(values, fieldValue)
+		}
+		valueType := uniformType(values)
+		if valueType == nil {
+			tmp := make(map[string]any, len(keys))
+			for i, key := range keys {
+				tmp[key] = values[i]
 			}
 			value = tmp
-		case TypeMap:
-			splitData, err := splitArgumentListData(content)
+			break
+		}
+		m := reflect.MakeMapWithSize(reflect.MapOf(reflect.TypeOf(""), valueType), len(keys))
+		for i, key := range keys {
+			m.SetMapIndex(reflect.ValueOf(key), reflect.ValueOf(values[i]))
+		}
+		value = m.Interface()
+	case TypeMap:
+		splitData, err := splitArgumentList(content, state, "elements", state.options.maxElementsOrDefault(), 2)
+		if err != nil {
+			return nil, err
+		}
+		if len(splitData)%2 != 0 {
+			return nil, fmt.Errorf("map has a key without a value")
+		}
+		keys := make([]any, 0, len(splitData)/2)
+		values := make([]any, 0, len(splitData)/2)
+		offset := state.offset
+		for i := 0; i < len(splitData); i += 2 {
+			keyPath := fmt.Sprintf("%s.keys[%d]", state.path, i/2)
+			keyFieldValue, err := decodeElement(splitData[i], state.at(offset), keyPath)
 			if err != nil {
-				return "", nil, 0, err
+				return nil, err
 			}
-			tmp := make(map[any]any)
-			for i := 0; i < len(splitData); i += 2 {
-				keyFieldData := splitData[i]
-				valueFieldData := splitData[i+1]
-
-				_, keyFieldValue, _, err := decodeArgument(keyFieldData)
-				if err != nil {
-					return "", nil, 0, err
+			if keyFieldValue != nil {
+				keyFieldValue = comparableKey(reflect.ValueOf(keyFieldValue)).Interface()
+				if !reflect.ValueOf(keyFieldValue).Comparable() {
+					return nil, fmt.Errorf("map key at %q of type %T is not comparable", keyPath, keyFieldValue)
 				}
+			}
+			offset += len(splitData[i])
 
-				_, valueFieldValue, _, err := decodeArgument(valueFieldData)
-				if err != nil {
-					return "", nil, 0, err
-				}
+			valueFieldValue, err := decodeElement(splitData[i+1], state.at(offset), fmt.Sprintf("%s[%v]", state.path, keyFieldValue))
+			if err != nil {
+				return nil, err
+			}
+			offset += len(splitData[i+1])
 
-				tmp[keyFieldValue] = valueFieldValue
+			keys = append(keys, keyFieldValue)
+			values = append(values, valueFieldValue)
+		}
+		keyType, valueType := uniformType(keys), uniformType(values)
+		if keyType == nil || valueType == nil {
+			tmp := make(map[any]any, len(keys))
+			for i, key := range keys {
+				tmp[key] = values[i]
 			}
 			value = tmp
-		default:
-			err = fmt.Errorf("Decoding for type '%s' not yet implemented", TypeToString[typ])
+			break
 		}
-
+		m := reflect.MakeMapWithSize(reflect.MapOf(keyType, valueType), len(keys))
+		for i, key := range keys {
+			m.SetMapIndex(reflect.ValueOf(key), reflect.ValueOf(values[i]))
+		}
+		value = m.Interface()
+	default:
+		err = fmt.Errorf("Decoding for type '%s' not yet implemented", TypeToString[typ])
 	}
 
 	return
 }
 
+func decodeElement(data []byte, state decodeState, path string) (any, error) {
+	elementState, err := state.child(path)
+	if err != nil {
+		return nil, err
+	}
+	_, typ, content, err := readArgument(data, elementState)
+	if err != nil {
+		return nil, err
+	}
+	return decodeContentWithState(typ, content, elementState.content(data, content))
+}
+
+// comparableKey rebuilds decoded slices as arrays of the same length, also
+// inside structs, so that map keys encoded from arrays are usable as keys
+// again.
+func comparableKey(value reflect.Value) reflect.Value {
+	if value.Comparable() {
+		return value
+	}
+
+	switch value.Kind() {
+	case reflect.Interface:
+		return comparableKey(value.Elem())
+	case reflect.Slice:
+		elemType := value.Type().Elem()
+		elements := make([]reflect.Value, value.Len())
+		for i := range elements {
+			elements[i] = comparableKey(value.Index(i))
+			if elemType.Kind() != reflect.Interface {
+				elemType = elements[i].Type()
+			}
+		}
+		array := reflect.New(reflect.ArrayOf(len(elements), elemType)).Elem()
+		for i, element := range elements {
+			array.Index(i).Set(element)
+		}
+		return array
+	case reflect.Struct:
+		fields := make([]reflect.StructField, value.NumField())
+		fieldValues := make([]reflect.Value, value.NumField())
+		for i := range fields {
+			fields[i] = value.Type().Field(i)
+			fieldValues[i] = comparableKey(value.Field(i))
+			if fields[i].Type.Kind() != reflect.Interface {
+				fields[i].Type = fieldValues[i].Type()
+			}
+		}
+		instance := reflect.New(reflect.StructOf(fields)).Elem()
+		for i, fieldValue := range fieldValues {
+			instance.Field(i).Set(fieldValue)
+		}
+		return instance
+	}
+	return value
+}
+
+func uniformType(values []any) reflect.Type {
+	if len(values) == 0 {
+		return nil
+	}
+	sameType := reflect.TypeOf(values[0])
+	for _, v := range values {
+		if reflect.TypeOf(v) != sameType {
+			return nil
+		}
+	}
+	return sameType
+}
+
 func splitArgumentListData(data []byte) ([][]byte, error) {
-	result := make([][]byte, 0)
+	return splitArgumentList(data, newDecodeState(Options()), "elements", DefaultMaxElements, 1)
+}
+
+func splitArgumentList(data []byte, state decodeState, limit string, max int, width int) (result [][]byte, err error) {
+	result = make([][]byte, 0)
 	buffer := bytes.NewBuffer(data)
+	offset := state.offset
+	defer func() {
+		err = state.at(offset).wrap(err)
+	}()
 
 	for {
 		if buffer.Len() == 0 {
 			break
 		}
+		offset = state.offset + len(data) - buffer.Len()
+		if len(result)/width >= max {
+			return nil, &LimitExceededError{Limit: limit, Path: state.path, Value: len(result)/width + 1, Max: max}
+		}
 
 		tmpBuffer := bytes.NewBuffer(nil)
 
 		untilFF, err := buffer.ReadBytes(0xFF)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("%w: unterminated identifier", ErrTruncated)
+		}
+		if len(untilFF)-2 > state.options.maxIdentifierLengthOrDefault() {
+			return nil, &LimitExceededError{Limit: "identifier length", Path: state.path, Value: len(untilFF) - 2, Max: state.options.maxIdentifierLengthOrDefault()}
 		}
 		tmpBuffer.Write(untilFF)
 
 		contentSizeDescriptor, err := buffer.ReadByte()
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("%w: missing size descriptor", ErrTruncated)
 		}
 		tmpBuffer.WriteByte(contentSizeDescriptor)
 
 		sizeBytes := buffer.Next(int(contentSizeDescriptor))
 		if len(sizeBytes) != int(contentSizeDescriptor) {
-			return nil, fmt.Errorf("not enough bytes for size descriptor")
+			return nil, fmt.Errorf("%w: not enough bytes for size descriptor", ErrTruncated)
 		}
 		tmpBuffer.Write(sizeBytes)
 
-		var size int
-		switch len(sizeBytes) {
-		case 1:
-			size = int(int8(sizeBytes[0]))
-		case 2:
-			size = int(int16(binary.BigEndian.Uint16(sizeBytes)))
-		case 4:
-			size = int(int32(binary.BigEndian.Uint32(sizeBytes)))
-		case 8:
-			size = int(int64(binary.BigEndian.Uint64(sizeBytes)))
-		default:
-			return nil, fmt.Errorf("invalid size descriptor: %v", sizeBytes)
+		size, err := readSize(sizeBytes)
+		if err != nil {
+			return nil, err
+		}
+		if size > buffer.Len() {
+			return nil, fmt.Errorf("%w: not enough bytes for content of %d bytes", ErrTruncated, size)
 		}
 
 		content := buffer.Next(size)
 		tmpBuffer.Write(content)
 
-		crc32Bytes := buffer.Next(4)
-		if len(crc32Bytes) != 4 {
-			return nil, fmt.Errorf("not enough bytes for CRC32")
+		checksumBytes := buffer.Next(state.checksum.size)
+		if len(checksumBytes) != state.checksum.size {
+			return nil, fmt.Errorf("%w: not enough bytes for checksum", ErrTruncated)
 		}
-		tmpBuffer.Write(crc32Bytes)
+		tmpBuffer.Write(checksumBytes)
 
 		result = append(result, tmpBuffer.Bytes())
 	}
@@ -298,11 +515,22 @@ func decodeFixedPrimitiveContent(typ byte, content []byte) (any, error) {
 	}
 }
 
-func readIdentifier(buffer *bytes.Buffer) (string, error) {
+func readIdentifier(buffer *bytes.Buffer, state decodeState) (string, error) {
 	identifierBytes, err := buffer.ReadBytes(0xFF)
-	return string(identifierBytes[:len(identifierBytes)-1]), err
+	if err != nil {
+		return "", fmt.Errorf("%w: unterminated identifier", ErrTruncated)
+	}
+	if len(identifierBytes)-1 > state.options.maxIdentifierLengthOrDefault() {
+		return "", &LimitExceededError{Limit: "identifier length", Path: state.path, Value: len(identifierBytes) - 1, Max: state.options.maxIdentifierLengthOrDefault()}
+	}
+	return string(identifierBytes[:len(identifierBytes)-1]), nil
 }
 
-func verifyChecksum(data []byte, checksum []byte) bool {
-	return crc32.ChecksumIEEE(data) == binary.BigEndian.Uint32(checksum)
+func decodingError(err error) error {
+	var decodingErr *DecodingError
+	var authenticationErr *AuthenticationError
+	if err == nil || errors.As(err, &decodingErr) || errors.As(err, &authenticationErr) {
+		return err
+	}
+	return &DecodingError{err: err}
 }
@@ -4,39 +4,40 @@ import (
 	"bytes"
 	"reflect"
 	"testing"
+	"time"
 )
 
-func TestDecodeFixedArgument(t *testing.T) {
-	tests := []struct {
-		name      string
-		data      []byte
-		expected  any
-		expectErr bool
-	}{
-		{"bool", []byte{
-			TypeBool, 'b', 'o', 'o', 'l', 0xFF, 0x01, 0x01, 0x01,
-		}, true, false},
-		{"byte", []byte{
-			TypeUInt8, 'b', 'y', 't', 'e', 0xFF, 0x01, 0x01, 0xDE,
-		}, byte(0xDE), false},
-		{"uint", []byte{
-			TypeUInt16, 'u', 'i', 'n', 't', 0xFF, 0x01, 0x02, 0x12, 0x34,
-		}, uint16(0x1234), false},
-		{"int", []byte{
-			TypeInt32, 'i', 'n', 't', 0xFF, 0x01, 0x04, 0xED, 0xCB, 0xA9, 0x88,
-		}, int32(-0x12345678), false},
-		{"float", []byte{
-			TypeFloat64, 'f', 'l', 'o', 'a', 't', 0xFF, 0x01, 0x08, 0x40, 0x09, 0x1E, 0xB8, 0x51, 0xEB, 0x85, 0x1F,
-		}, float64(3.14), false},
-		{"complex", []byte{
-			TypeComplex128, 'c', 'o', 'm', 'p', 'l', 'e', 'x', 0xFF, 0x01, 0x10, 0x40, 0x51, 0x40, 0x00, 0x00, 0x00, 0x00, 0x00, 0x40, 0x7A, 0x40, 0x00, 0x00, 0x00, 0x00, 0x00,
-		}, complex128(69.0 + 420.0i), false},
-	}
+var decodeFixedArgumentTests = []struct {
+	name      string
+	data      []byte
+	expected  any
+	expectErr bool
+}{
+	{"bool", []byte{
+		TypeBool, 'b', 'o', 'o', 'l', 0xFF, 0x01, 0x01, 0x01,
+	}, true, false},
+	{"byte", []byte{
+		TypeUInt8, 'b', 'y', 't', 'e', 0xFF, 0x01, 0x01, 0xDE,
+	}, byte(0xDE), false},
+	{"uint", []byte{
+		TypeUInt16, 'u', 'i', 'n', 't', 0xFF, 0x01, 0x02, 0x12, 0x34,
+	}, uint16(0x1234), false},
+	{"int", []byte{
+		TypeInt32, 'i', 'n', 't', 0xFF, 0x01, 0x04, 0xED, 0xCB, 0xA9, 0x88,
+	}, int32(-0x12345678), false},
+	{"float", []byte{
+		TypeFloat64, 'f', 'l', 'o', 'a', 't', 0xFF, 0x01, 0x08, 0x40, 0x09, 0x1E, 0xB8, 0x51, 0xEB, 0x85, 0x1F,
+	}, float64(3.14), false},
+	{"complex", []byte{
+		TypeComplex128, 'c', 'o', 'm', 'p', 'l', 'e', 'x', 0xFF, 0x01, 0x10, 0x40, 0x51, 0x40, 0x00, 0x00, 0x00, 0x00, 0x00, 0x40, 0x7A, 0x40, 0x00, 0x00, 0x00, 0x00, 0x00,
+	}, complex128(69.0 + 420.0i), false},
+}
 
-	for _, tt := range tests {
+func TestDecodeFixedArgument(t *testing.T) {
+	for _, tt := range decodeFixedArgumentTests {
 		t.Run(tt.name, func(t *testing.T) {
 			buffer := bytes.NewBuffer(tt.data)
-			err := writeChecksum(buffer)
+			err := writeChecksum(buffer, checksums[ChecksumCRC32])
 			if err != nil {
 				t.Fatalf("error writing checksum: %v", err)
 			}
@@ -83,7 +84,7 @@ func TestDecodeStringArgument(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			buffer := bytes.NewBuffer(tt.data)
-			err := writeChecksum(buffer)
+			err := writeChecksum(buffer, checksums[ChecksumCRC32])
 			if err != nil {
 				t.Fatalf("error writing checksum: %v", err)
 			}
@@ -164,14 +165,14 @@ func TestSplitArgumentListData(t *testing.T) {
 	first := bytes.NewBuffer([]byte{
 		TypeUInt8, 'B', 'y', 't', 'e', 0xFF, 0x01, 0x01, 0xDE,
 	})
-	err := writeChecksum(first)
+	err := writeChecksum(first, checksums[ChecksumCRC32])
 	if err != nil {
 		t.Fatalf("error writing checksum: %v", err)
 	}
 	second := bytes.NewBuffer([]byte{
 		TypeString, 'S', 't', 'r', 0xFF, 0x01, 0x0A, 0x6D, 0x6F, 0x69, 0x6E, 0x20, 0x64, 0x69, 0x6B, 0x6B, 0x61,
 	})
-	err = writeChecksum(second)
+	err = writeChecksum(second, checksums[ChecksumCRC32])
 	if err != nil {
 		t.Fatalf("error writing checksum: %v", err)
 	}
@@ -255,7 +256,7 @@ func TestDecodeSlice(t *testing.T) {
 		dataRaw   any
 		expectErr bool
 	}{
-		{"primitives", []byte{0xDE, 0x68, 0xAA}, false},
+		{"primitives", []int{0xDE, 0x68, 0xAA}, false},
 		{"strings", []string{"moin", "dikka"}, false},
 		{"empty", []any{}, false},
 		{"mixed", []any{byte(0xDE), "moin"}, false},
@@ -301,7 +302,7 @@ func TestDecodeMapStringKey(t *testing.T) {
 		{"primitives", map[string]any{"first": byte(0xDE), "second": "moin"}, false},
 		{"empty", map[string]any{}, false},
 		{"mixed", map[string]any{"first": byte(0xDE), "second": "moin"}, false},
-		{"nested", map[string]any{"first": map[string]any{"second": byte(0xDE)}}, false},
+		{"nested", map[string]map[string]byte{"first": {"second": 0xDE}}, false},
 	}
 
 	for _, tt := range tests {
@@ -343,7 +344,7 @@ func TestDecodeMap(t *testing.T) {
 		{"primitives", map[any]any{byte(0xDE): "moin", "dikka": byte(0xAA)}},
 		{"empty", map[any]any{}},
 		{"mixed", map[any]any{byte(0xDE): "moin", "dikka": byte(0xAA)}},
-		{"nested", map[any]any{byte(0xDE): map[any]any{"nested": byte(0xAA)}}},
+		{"nested", map[byte]map[string]byte{0xDE: {"nested": 0xAA}}},
 	}
 
 	for _, tt := range tests {
@@ -375,3 +376,264 @@ func TestDecodeMap(t *testing.T) {
 		})
 	}
 }
+
+func TestDecodeStructWithWireNames(t *testing.T) {
+	type tagged struct {
+		UserName string `protocol:"user_name"`
+		Age      byte   `protocol:"age"`
+	}
+
+	data := bytes.NewBuffer(nil)
+	err := encodeArgument(data, tagged{UserName: "moin", Age: 42}, "tagged")
+	if err != nil {
+		t.Fatalf("error encoding argument: %v", err)
+	}
+
+	_, value, typ, err := decodeArgument(data.Bytes())
+	if err != nil {
+		t.Fatalf("error decoding argument: %v", err)
+	}
+
+	if typ != TypeStruct {
+		t.Fatalf("expected type: %v, got: %v", TypeToString[TypeStruct], TypeToString[typ])
+	}
+
+	reencoded := bytes.NewBuffer(nil)
+	err = encodeArgument(reencoded, value, "tagged")
+	if err != nil {
+		t.Fatalf("error encoding argument: %v", err)
+	}
+
+	if !bytes.Equal(reencoded.Bytes(), data.Bytes()) {
+		t.Fatalf(`
+diff
+%s
+		`, compareBytes(data.Bytes(), reencoded.Bytes()))
+	}
+}
+
+func TestDecodeNil(t *testing.T) {
+	tests := []struct {
+		name     string
+		dataRaw  any
+		expected any
+	}{
+		{"nil", nil, nil},
+		{"slice with nil", []any{nil, nil}, []any{nil, nil}},
+		{"map with nil", map[string]any{"nothing": nil}, map[string]any{"nothing": nil}},
+		{"struct with nil", struct{ Nothing *int }{}, struct{ Nothing any }{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := bytes.NewBuffer(nil)
+			err := encodeArgument(data, tt.dataRaw, tt.name)
+			if err != nil {
+				t.Fatalf("error encoding argument: %v", err)
+			}
+
+			_, value, _, err := decodeArgument(data.Bytes())
+			if err != nil {
+				t.Fatalf("error decoding argument: %v", err)
+			}
+
+			if !reflect.DeepEqual(value, tt.expected) {
+				t.Fatalf("expected: %#v, got: %#v", tt.expected, value)
+			}
+		})
+	}
+}
+
+func TestDecodeTypedMap(t *testing.T) {
+	tests := []struct {
+		name     string
+		dataRaw  any
+		expected any
+	}{
+		{"int to string", map[int]string{1: "moin", -2: "dikka"}, map[int]string{1: "moin", -2: "dikka"}},
+		{"string to int", map[string]int{"moin": 1, "dikka": 2}, map[string]int{"moin": 1, "dikka": 2}},
+		{"mixed values", map[string]any{"moin": 1, "dikka": "2"}, map[string]any{"moin": 1, "dikka": "2"}},
+		{"mixed keys", map[any]int{1: 1, "2": 2}, map[any]any{1: 1, "2": 2}},
+		{"struct keys", map[struct{ X, Y int }]bool{{1, 2}: true}, map[struct{ X, Y int }]bool{{1, 2}: true}},
+		{"byte array keys", map[[4]byte]string{{1, 2, 3, 4}: "x"}, map[[4]byte]string{{1, 2, 3, 4}: "x"}},
+		{"packed array keys", map[[2]int32]string{{1, -2}: "x"}, map[[2]int32]string{{1, -2}: "x"}},
+		{"string array keys", map[[2]string]int{{"moin", "dikka"}: 1}, map[[2]string]int{{"moin", "dikka"}: 1}},
+		{"nested array keys", map[[2][2]byte]int{{{1, 2}, {3, 4}}: 1}, map[[2][2]byte]int{{{1, 2}, {3, 4}}: 1}},
+		{"struct with array keys", map[struct{ A [2]byte }]int{{[2]byte{1, 2}}: 1}, map[struct{ A [2]byte }]int{{[2]byte{1, 2}}: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := bytes.NewBuffer(nil)
+			err := encodeArgument(data, tt.dataRaw, tt.name)
+			if err != nil {
+				t.Fatalf("error encoding argument: %v", err)
+			}
+
+			_, value, _, err := decodeArgument(data.Bytes())
+			if err != nil {
+				t.Fatalf("error decoding argument: %v", err)
+			}
+
+			if !reflect.DeepEqual(value, tt.expected) {
+				t.Fatalf("expected: %#v, got: %#v", tt.expected, value)
+			}
+		})
+	}
+}
+
+func TestDecodeTimeAndDuration(t *testing.T) {
+	local := time.Date(2024, 3, 31, 2, 30, 0, 123456789, time.FixedZone("CEST", 7200))
+
+	tests := []struct {
+		name    string
+		dataRaw any
+	}{
+		{"utc", time.Date(2024, 3, 31, 0, 30, 0, 1, time.UTC)},
+		{"zone", local},
+		{"before epoch", time.Date(1912, 4, 15, 2, 20, 0, 0, time.UTC)},
+		{"duration", 90 * time.Minute},
+		{"negative duration", -time.Nanosecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := bytes.NewBuffer(nil)
+			err := encodeArgument(data, tt.dataRaw, tt.name)
+			if err != nil {
+				t.Fatalf("error encoding argument: %v", err)
+			}
+
+			_, value, _, err := decodeArgument(data.Bytes())
+			if err != nil {
+				t.Fatalf("error decoding argument: %v", err)
+			}
+
+			if !reflect.DeepEqual(value, tt.dataRaw) {
+				t.Fatalf("expected: %#v, got: %#v", tt.dataRaw, value)
+			}
+		})
+	}
+}
+
+func TestDecodeBytes(t *testing.T) {
+	tests := []struct {
+		name     string
+		dataRaw  any
+		expected any
+	}{
+		{"slice", []byte{0xDE, 0x68, 0xAA}, []byte{0xDE, 0x68, 0xAA}},
+		{"array", [2]byte{0xDE, 0x68}, []byte{0xDE, 0x68}},
+		{"empty", []byte{}, []byte{}},
+		{"nested", [][]byte{{0xDE}, {0x68, 0xAA}}, [][]byte{{0xDE}, {0x68, 0xAA}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := bytes.NewBuffer(nil)
+			err := encodeArgument(data, tt.dataRaw, tt.name)
+			if err != nil {
+				t.Fatalf("error encoding argument: %v", err)
+			}
+
+			_, value, _, err := decodeArgument(data.Bytes())
+			if err != nil {
+				t.Fatalf("error decoding argument: %v", err)
+			}
+
+			if !reflect.DeepEqual(value, tt.expected) {
+				t.Fatalf("expected: %#v, got: %#v", tt.expected, value)
+			}
+		})
+	}
+}
+
+func TestDecodePackedSlice(t *testing.T) {
+	tests := []struct {
+		name     string
+		dataRaw  any
+		expected any
+	}{
+		{"int32", []int32{1, -2, 3}, []int32{1, -2, 3}},
+		{"float64", []float64{3.14, -1}, []float64{3.14, -1}},
+		{"complex64", []complex64{1 + 2i}, []complex64{1 + 2i}},
+		{"bools", []bool{true, false, true, false, true, false, true, false, true}, []bool{true, false, true, false, true, false, true, false, true}},
+		{"empty bools", []bool{}, []bool{}},
+		{"array", [3]uint16{1, 2, 3}, []uint16{1, 2, 3}},
+		{"nested", [][]float32{{1}, {2, 3}}, [][]float32{{1}, {2, 3}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := bytes.NewBuffer(nil)
+			err := encodeArgument(data, tt.dataRaw, tt.name)
+			if err != nil {
+				t.Fatalf("error encoding argument: %v", err)
+			}
+
+			_, value, _, err := decodeArgument(data.Bytes())
+			if err != nil {
+				t.Fatalf("error decoding argument: %v", err)
+			}
+
+			if !reflect.DeepEqual(value, tt.expected) {
+				t.Fatalf("expected: %#v, got: %#v", tt.expected, value)
+			}
+		})
+	}
+}
+
+func TestDecodePackedSliceInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+	}{
+		{"no element type", []byte{}},
+		{"unknown element type", []byte{TypeString, 'm'}},
+		{"partial element", []byte{TypeInt32, 0x00, 0x00, 0x01}},
+		{"bool padding", []byte{TypeBool, 0x08, 0xFF}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeContent(TypePackedSlice, tt.content)
+			if err == nil {
+				t.Fatalf("expected error")
+			}
+		})
+	}
+}
+
+func TestDecodeMalformedArgument(t *testing.T) {
+	element := bytes.NewBuffer(nil)
+	_ = encodeArgument(element, 1, "")
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", []byte{}},
+		{"shorter than checksum", []byte{0x01, 0x02, 0x03}},
+		{"only checksum", withFixedChecksum([]byte{0, 0, 0, 0})},
+		{"unterminated identifier", withFixedChecksum([]byte{TypeString, 'a', 'b', 0, 0, 0, 0})},
+		{"missing size descriptor", withFixedChecksum([]byte{TypeString, 0xFF, 0, 0, 0, 0})},
+		{"invalid size descriptor", withFixedChecksum([]byte{TypeString, 0xFF, 3, 0, 0, 1, 'a', 0, 0, 0, 0})},
+		{"negative size", withFixedChecksum([]byte{TypeString, 0xFF, 1, 0xFF, 'a', 0, 0, 0, 0})},
+		{"size beyond content", withFixedChecksum([]byte{TypeString, 0xFF, 1, 5, 'a', 0, 0, 0, 0})},
+		{"size before content end", withFixedChecksum([]byte{TypeString, 0xFF, 1, 1, 'a', 'b', 0, 0, 0, 0})},
+		{"short int", withFixedChecksum([]byte{TypeInt, 0xFF, 1, 2, 0x00, 0x01, 0, 0, 0, 0})},
+		{"long int32", withFixedChecksum([]byte{TypeInt32, 0xFF, 1, 5, 0, 0, 0, 0, 1, 0, 0, 0, 0})},
+		{"unknown type", withFixedChecksum([]byte{0xEE, 0xFF, 1, 0, 0, 0, 0, 0})},
+		{"map without value", withFixedChecksum(append(append([]byte{TypeMap, 0xFF, 1, byte(element.Len())}, element.Bytes()...), 0, 0, 0, 0))},
+		{"truncated nested argument", withFixedChecksum(append(append([]byte{TypeSlice, 0xFF, 1, byte(element.Len() - 2)}, element.Bytes()[:element.Len()-2]...), 0, 0, 0, 0))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, _, err := decodeArgument(tt.data)
+			if err == nil {
+				t.Fatalf("expected error")
+			}
+		})
+	}
+}
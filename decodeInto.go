@@ -0,0 +1,433 @@
+package protocol
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+)
+
+func DecodeFunctionCallInto(data []byte, options *options, target any) (string, error) {
+	message, err := readMessage(data, options)
+	if err != nil {
+		return "", decodingError(err)
+	}
+	if message.kind != KindCall {
+		return "", &UnexpectedMessageKindError{Expected: KindCall, Actual: message.kind}
+	}
+	name, splitData, subversion := message.name, message.arguments, message.subversion
+	state := newMessageState(message, options)
+
+	if targets, ok := target.(map[string]any); ok {
+		offset := message.argumentsOffset
+		for _, argData := range splitData {
+			argState := state.at(offset)
+			offset += len(argData)
+			argName, typ, content, err := readArgument(argData, argState)
+			if err != nil {
+				return "", err
+			}
+			argTarget, ok := targets[argName]
+			if !ok {
+				continue
+			}
+			value, err := targetValue(argTarget)
+			if err != nil {
+				return "", err
+			}
+			argState, err = argState.field(argName)
+			if err != nil {
+				return "", err
+			}
+			err = decodeContentInto(typ, content, value, argState.content(argData, content))
+			if err != nil {
+				return "", err
+			}
+		}
+		return name, checkSubversion(options, subversion)
+	}
+
+	value, err := targetValue(target)
+	if err != nil {
+		return "", err
+	}
+	if value.Kind() != reflect.Struct {
+		return "", &InvalidTargetError{Type: reflect.TypeOf(target)}
+	}
+	fields := cachedStructFields(value.Type())
+
+	offset := message.argumentsOffset
+	for _, argData := range splitData {
+		argState := state.at(offset)
+		offset += len(argData)
+		argName, typ, content, err := readArgument(argData, argState)
+		if err != nil {
+			return "", err
+		}
+		field, ok := fields.byWireName(argName)
+		if !ok {
+			continue
+		}
+		fieldValue, ok := fieldByIndexAlloc(value, field.index)
+		if !ok {
+			continue
+		}
+		argState, err = argState.field(argName)
+		if err != nil {
+			return "", err
+		}
+		err = decodeContentInto(typ, content, fieldValue, argState.content(argData, content))
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return name, checkSubversion(options, subversion)
+}
+
+func (a Argument) DecodeInto(target any) error {
+	value, err := targetValue(target)
+	if err != nil {
+		return err
+	}
+	if a.raw == nil {
+		return fmt.Errorf("argument %q carries no encoded data", a.Name)
+	}
+
+	state := a.state
+	if state.options == nil {
+		state = newDecodeState(Options())
+	}
+	_, typ, content, err := readArgument(a.raw, state)
+	if err != nil {
+		return err
+	}
+	argState, err := state.field(a.Name)
+	if err != nil {
+		return err
+	}
+	return decodeContentInto(typ, content, value, argState.content(a.raw, content))
+}
+
+func targetValue(target any) (reflect.Value, error) {
+	value := reflect.ValueOf(target)
+	if value.Kind() != reflect.Ptr || value.IsNil() {
+		return reflect.Value{}, &InvalidTargetError{Type: reflect.TypeOf(target)}
+	}
+	return value.Elem(), nil
+}
+
+func decodeContentInto(typ byte, content []byte, target reflect.Value, state decodeState) (err error) {
+	defer func() {
+		err = state.wrap(err)
+	}()
+	state = state.nested()
+	path := state.path
+
+	if typ == TypeNil {
+		target.Set(reflect.Zero(target.Type()))
+		return nil
+	}
+
+	switch target.Kind() {
+	case reflect.Ptr:
+		if target.IsNil() {
+			target.Set(reflect.New(target.Type().Elem()))
+		}
+		return decodeContentInto(typ, content, target.Elem(), state)
+	case reflect.Interface:
+		value, err := decodeContentWithState(typ, content, state)
+		if err != nil {
+			return err
+		}
+		if value == nil || !reflect.TypeOf(value).AssignableTo(target.Type()) {
+			return &TypeMismatchError{Path: path, Typ: typ, Target: target.Type()}
+		}
+		target.Set(reflect.ValueOf(value))
+		return nil
+	}
+
+	if ok, err := unmarshalValue(typ, content, target); ok {
+		return err
+	}
+
+	switch typ {
+	case TypeStruct:
+		if target.Kind() != reflect.Struct {
+			return &TypeMismatchError{Path: path, Typ: typ, Target: target.Type()}
+		}
+		fields := cachedStructFields(target.Type())
+		if state.options.errorOnUnexportedFields && len(fields.unexported) > 0 {
+			return &UnexportedFieldError{Type: target.Type(), Field: fields.unexported[0]}
+		}
+		splitData, err := splitArgumentList(content, state, "elements", state.options.maxElementsOrDefault(), 1)
+		if err != nil {
+			return err
+		}
+		offset := state.offset
+		for _, fieldData := range splitData {
+			fieldOffset := offset
+			offset += len(fieldData)
+			name, fieldTyp, fieldContent, err := readArgument(fieldData, state.at(fieldOffset))
+			if err != nil {
+				return err
+			}
+			field, ok := fields.byWireName(name)
+			if !ok {
+				continue
+			}
+			fieldValue, ok := fieldByIndexAlloc(target, field.index)
+			if !ok {
+				continue
+			}
+			fieldState, err := state.at(fieldOffset).field(name)
+			if err != nil {
+				return err
+			}
+			err = decodeContentInto(fieldTyp, fieldContent, fieldValue, fieldState.content(fieldData, fieldContent))
+			if err != nil {
+				return err
+			}
+		}
+	case TypeSlice:
+		if target.Kind() != reflect.Slice && target.Kind() != reflect.Array {
+			return &TypeMismatchError{Path: path, Typ: typ, Target: target.Type()}
+		}
+		splitData, err := splitArgumentList(content, state, "elements", state.options.maxElementsOrDefault(), 1)
+		if err != nil {
+			return err
+		}
+		elements := makeSequence(target, len(splitData))
+		offset := state.offset
+		for i, elementData := range splitData {
+			if i >= elements.Len() {
+				break
+			}
+			elementState, err := state.at(offset).child(fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return err
+			}
+			offset += len(elementData)
+			_, elementTyp, elementContent, err := readArgument(elementData, elementState)
+			if err != nil {
+				return err
+			}
+			err = decodeContentInto(elementTyp, elementContent, elements.Index(i), elementState.content(elementData, elementContent))
+			if err != nil {
+				return err
+			}
+		}
+		if target.Kind() == reflect.Slice {
+			target.Set(elements)
+		}
+	case TypeBytes:
+		if !isByteSequence(target.Type()) {
+			return &TypeMismatchError{Path: path, Typ: typ, Target: target.Type()}
+		}
+		elements := makeSequence(target, len(content))
+		if elements.Type().Elem() == reflect.TypeOf(byte(0)) {
+			reflect.Copy(elements, reflect.ValueOf(content))
+		} else {
+			for i := 0; i < len(content) && i < elements.Len(); i++ {
+				elements.Index(i).SetUint(uint64(content[i]))
+			}
+		}
+		if target.Kind() == reflect.Slice {
+			target.Set(elements)
+		}
+	case TypePackedSlice:
+		if target.Kind() != reflect.Slice && target.Kind() != reflect.Array {
+			return &TypeMismatchError{Path: path, Typ: typ, Target: target.Type()}
+		}
+		decoded, err := decodePackedSlice(content, state)
+		if err != nil {
+			return err
+		}
+		if decoded.Type() == target.Type() {
+			target.Set(decoded)
+			return nil
+		}
+		elements := makeSequence(target, decoded.Len())
+		for i := 0; i < decoded.Len() && i < elements.Len(); i++ {
+			err = assignValue(elements.Index(i), decoded.Index(i), content[0], fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return err
+			}
+		}
+		if target.Kind() == reflect.Slice {
+			target.Set(elements)
+		}
+	case TypeMapStringKey:
+		if target.Kind() != reflect.Map || target.Type().Key().Kind() != reflect.String {
+			return &TypeMismatchError{Path: path, Typ: typ, Target: target.Type()}
+		}
+		splitData, err := splitArgumentList(content, state, "elements", state.options.maxElementsOrDefault(), 1)
+		if err != nil {
+			return err
+		}
+		m := reflect.MakeMapWithSize(target.Type(), len(splitData))
+		offset := state.offset
+		for _, elementData := range splitData {
+			key, elementTyp, elementContent, err := readArgument(elementData, state.at(offset))
+			if err != nil {
+				return err
+			}
+			elementState, err := state.at(offset).child(fmt.Sprintf("%s[%q]", path, key))
+			if err != nil {
+				return err
+			}
+			offset += len(elementData)
+			element := reflect.New(target.Type().Elem()).Elem()
+			err = decodeContentInto(elementTyp, elementContent, element, elementState.content(elementData, elementContent))
+			if err != nil {
+				return err
+			}
+			m.SetMapIndex(reflect.ValueOf(key).Convert(target.Type().Key()), element)
+		}
+		target.Set(m)
+	case TypeMap:
+		if target.Kind() != reflect.Map {
+			return &TypeMismatchError{Path: path, Typ: typ, Target: target.Type()}
+		}
+		splitData, err := splitArgumentList(content, state, "elements", state.options.maxElementsOrDefault(), 2)
+		if err != nil {
+			return err
+		}
+		if len(splitData)%2 != 0 {
+			return fmt.Errorf("map at %q has a key without a value", path)
+		}
+		m := reflect.MakeMapWithSize(target.Type(), len(splitData)/2)
+		offset := state.offset
+		for i := 0; i < len(splitData); i += 2 {
+			keyPath := fmt.Sprintf("%s.keys[%d]", path, i/2)
+			keyState, err := state.at(offset).child(keyPath)
+			if err != nil {
+				return err
+			}
+			offset += len(splitData[i])
+			_, keyTyp, keyContent, err := readArgument(splitData[i], keyState)
+			if err != nil {
+				return err
+			}
+			key := reflect.New(target.Type().Key()).Elem()
+			err = decodeContentInto(keyTyp, keyContent, key, keyState.content(splitData[i], keyContent))
+			if err != nil {
+				return err
+			}
+			if !key.Comparable() {
+				return fmt.Errorf("map key at %q is not comparable", keyPath)
+			}
+
+			elementState, err := state.at(offset).child(fmt.Sprintf("%s[%v]", path, key.Interface()))
+			if err != nil {
+				return err
+			}
+			offset += len(splitData[i+1])
+			_, elementTyp, elementContent, err := readArgument(splitData[i+1], elementState)
+			if err != nil {
+				return err
+			}
+			element := reflect.New(target.Type().Elem()).Elem()
+			err = decodeContentInto(elementTyp, elementContent, element, elementState.content(splitData[i+1], elementContent))
+			if err != nil {
+				return err
+			}
+			m.SetMapIndex(key, element)
+		}
+		target.Set(m)
+	default:
+		value, err := decodeContentWithState(typ, content, state)
+		if err != nil {
+			return err
+		}
+		return assignValue(target, reflect.ValueOf(value), typ, path)
+	}
+
+	return nil
+}
+
+func makeSequence(target reflect.Value, length int) reflect.Value {
+	if target.Kind() == reflect.Slice {
+		return reflect.MakeSlice(target.Type(), length, length)
+	}
+	target.Set(reflect.Zero(target.Type()))
+	return target
+}
+
+func assignValue(target reflect.Value, value reflect.Value, typ byte, path string) error {
+	if target.Kind() == reflect.Ptr {
+		if target.IsNil() {
+			target.Set(reflect.New(target.Type().Elem()))
+		}
+		return assignValue(target.Elem(), value, typ, path)
+	}
+	if value.Type().AssignableTo(target.Type()) {
+		target.Set(value)
+		return nil
+	}
+	return assignPrimitive(target, value, typ, path)
+}
+
+func assignPrimitive(target reflect.Value, value reflect.Value, typ byte, path string) error {
+	switch {
+	case target.Kind() == reflect.Bool && value.Kind() == reflect.Bool:
+		target.SetBool(value.Bool())
+		return nil
+	case target.Kind() == reflect.String && value.Kind() == reflect.String:
+		target.SetString(value.String())
+		return nil
+	case isIntKind(target.Kind()) && isIntKind(value.Kind()):
+		if target.OverflowInt(value.Int()) {
+			return &OverflowError{Path: path, Value: value.Interface(), Target: target.Type()}
+		}
+		target.SetInt(value.Int())
+		return nil
+	case isIntKind(target.Kind()) && isUintKind(value.Kind()):
+		if value.Uint() > math.MaxInt64 || target.OverflowInt(int64(value.Uint())) {
+			return &OverflowError{Path: path, Value: value.Interface(), Target: target.Type()}
+		}
+		target.SetInt(int64(value.Uint()))
+		return nil
+	case isUintKind(target.Kind()) && isUintKind(value.Kind()):
+		if target.OverflowUint(value.Uint()) {
+			return &OverflowError{Path: path, Value: value.Interface(), Target: target.Type()}
+		}
+		target.SetUint(value.Uint())
+		return nil
+	case isUintKind(target.Kind()) && isIntKind(value.Kind()):
+		if value.Int() < 0 || target.OverflowUint(uint64(value.Int())) {
+			return &OverflowError{Path: path, Value: value.Interface(), Target: target.Type()}
+		}
+		target.SetUint(uint64(value.Int()))
+		return nil
+	case isFloatKind(target.Kind()) && isFloatKind(value.Kind()):
+		if target.OverflowFloat(value.Float()) {
+			return &OverflowError{Path: path, Value: value.Interface(), Target: target.Type()}
+		}
+		target.SetFloat(value.Float())
+		return nil
+	case isComplexKind(target.Kind()) && isComplexKind(value.Kind()):
+		if target.OverflowComplex(value.Complex()) {
+			return &OverflowError{Path: path, Value: value.Interface(), Target: target.Type()}
+		}
+		target.SetComplex(value.Complex())
+		return nil
+	}
+
+	return &TypeMismatchError{Path: path, Typ: typ, Target: target.Type()}
+}
+
+func isIntKind(kind reflect.Kind) bool {
+	return kind >= reflect.Int && kind <= reflect.Int64
+}
+
+func isUintKind(kind reflect.Kind) bool {
+	return kind >= reflect.Uint && kind <= reflect.Uintptr
+}
+
+func isFloatKind(kind reflect.Kind) bool {
+	return kind == reflect.Float32 || kind == reflect.Float64
+}
+
+func isComplexKind(kind reflect.Kind) bool {
+	return kind == reflect.Complex64 || kind == reflect.Complex128
+}
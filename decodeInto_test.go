@@ -0,0 +1,466 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type decodeIntoAddress struct {
+	Street string
+	Zip    uint16
+}
+
+type decodeIntoUser struct {
+	Name      string
+	Age       int
+	Addresses []decodeIntoAddress
+	Scores    map[string]any
+	Extra     any
+}
+
+func TestDecodeFunctionCallIntoStruct(t *testing.T) {
+	user := decodeIntoUser{
+		Name: "moin",
+		Age:  42,
+		Addresses: []decodeIntoAddress{
+			{Street: "Hafenstraße", Zip: 20359},
+			{Street: "Elbchaussee", Zip: 22763},
+		},
+		Scores: map[string]any{"first": int32(1), "second": "two"},
+		Extra:  "dikka",
+	}
+	options := Options()
+
+	data, err := EncodeFunctionCall("update", options, map[string]any{
+		"User":    user,
+		"Force":   true,
+		"Unknown": "ignored",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var target struct {
+		User  decodeIntoUser
+		Force bool
+	}
+	name, err := DecodeFunctionCallInto(data, options, &target)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if name != "update" {
+		t.Fatalf("expected name %q, got %q", "update", name)
+	}
+
+	if !target.Force {
+		t.Fatalf("expected Force to be set")
+	}
+
+	if !reflect.DeepEqual(target.User, user) {
+		t.Fatalf("expected: %#v, got: %#v", user, target.User)
+	}
+}
+
+func TestDecodeFunctionCallIntoArgumentPointers(t *testing.T) {
+	options := Options()
+	data, err := EncodeFunctionCall("add", options, map[string]any{
+		"a": 1,
+		"b": byte(2),
+		"c": map[any]any{byte(1): "one", byte(2): "two"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var a int64
+	var b uint
+	var c map[uint16]string
+	_, err = DecodeFunctionCallInto(data, options, map[string]any{"a": &a, "b": &b, "c": &c})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if a != 1 || b != 2 {
+		t.Fatalf("expected 1 and 2, got %v and %v", a, b)
+	}
+
+	expected := map[uint16]string{1: "one", 2: "two"}
+	if !reflect.DeepEqual(c, expected) {
+		t.Fatalf("expected: %#v, got: %#v", expected, c)
+	}
+}
+
+func TestArgumentDecodeInto(t *testing.T) {
+	options := Options()
+	data, err := EncodeFunctionCall("nested", options, map[string]any{
+		"matrix": [][]int{{1, 2}, {3}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, args, err := DecodeFunctionCall(data, options)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var matrix [][]int16
+	err = args["matrix"].DecodeInto(&matrix)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := [][]int16{{1, 2}, {3}}
+	if !reflect.DeepEqual(matrix, expected) {
+		t.Fatalf("expected: %#v, got: %#v", expected, matrix)
+	}
+}
+
+func TestDecodeIntoErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   map[string]any
+		target any
+		check  func(error) bool
+	}{
+		{"mismatch", map[string]any{"User": decodeIntoAddress{Street: "moin"}}, &struct{ User struct{ Street int } }{}, func(err error) bool {
+			var mismatch *TypeMismatchError
+			return errors.As(err, &mismatch) && mismatch.Path == "User.Street" && mismatch.Typ == TypeString
+		}},
+		{"overflow", map[string]any{"Value": 300}, &struct{ Value uint8 }{}, func(err error) bool {
+			var overflow *OverflowError
+			return errors.As(err, &overflow) && overflow.Path == "Value"
+		}},
+		{"negative into unsigned", map[string]any{"Value": -1}, &struct{ Value uint }{}, func(err error) bool {
+			var overflow *OverflowError
+			return errors.As(err, &overflow)
+		}},
+		{"slice element", map[string]any{"Values": []string{"moin", "dikka"}}, &struct{ Values []bool }{}, func(err error) bool {
+			var mismatch *TypeMismatchError
+			return errors.As(err, &mismatch) && mismatch.Path == "Values[0]"
+		}},
+		{"non-pointer", map[string]any{"Value": 1}, struct{ Value int }{}, func(err error) bool {
+			var invalid *InvalidTargetError
+			return errors.As(err, &invalid)
+		}},
+		{"non-struct", map[string]any{"Value": 1}, new(int), func(err error) bool {
+			var invalid *InvalidTargetError
+			return errors.As(err, &invalid)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := Options()
+			data, err := EncodeFunctionCall(tt.name, options, tt.args)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			_, err = DecodeFunctionCallInto(data, options, tt.target)
+			if !tt.check(err) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestDecodeIntoStructTags(t *testing.T) {
+	type sent struct {
+		Name   string `protocol:"name"`
+		Secret string `protocol:"-"`
+		Note   string `protocol:"note,omitempty"`
+	}
+	type received struct {
+		FullName string `protocol:"name"`
+		Secret   string `protocol:"-"`
+		Note     string `protocol:"note"`
+	}
+
+	options := Options()
+	data, err := EncodeFunctionCall("tags", options, map[string]any{
+		"user": sent{Name: "moin", Secret: "hunter2"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var target struct {
+		User received `protocol:"user"`
+	}
+	_, err = DecodeFunctionCallInto(data, options, &target)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := received{FullName: "moin"}
+	if target.User != expected {
+		t.Fatalf("expected: %#v, got: %#v", expected, target.User)
+	}
+}
+
+func TestDecodeIntoPointers(t *testing.T) {
+	type optional struct {
+		Set     *int
+		Zero    *int
+		Missing *int
+		Nested  *decodeIntoAddress
+		List    []string
+		Lookup  map[string]any
+	}
+
+	set := 42
+	zero := 0
+	sent := optional{
+		Set:    &set,
+		Zero:   &zero,
+		Nested: &decodeIntoAddress{Street: "Hafenstraße", Zip: 20359},
+	}
+
+	options := Options()
+	data, err := EncodeFunctionCall("optional", options, map[string]any{"Value": sent})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	missing := 1
+	target := struct{ Value optional }{
+		Value: optional{Missing: &missing, List: []string{"stale"}},
+	}
+	_, err = DecodeFunctionCallInto(data, options, &target)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(target.Value, sent) {
+		t.Fatalf("expected: %#v, got: %#v", sent, target.Value)
+	}
+}
+
+func TestDecodeIntoEmbeddedStructs(t *testing.T) {
+	type Timestamps struct {
+		Created int64
+		Updated int64
+	}
+	type Owner struct {
+		Owner string
+	}
+	type document struct {
+		Timestamps
+		*Owner
+		Title   string
+		private string
+	}
+
+	sent := document{
+		Timestamps: Timestamps{Created: 1, Updated: 2},
+		Owner:      &Owner{Owner: "moin"},
+		Title:      "dikka",
+		private:    "secret",
+	}
+
+	options := Options()
+	data, err := EncodeFunctionCall("embedded", options, map[string]any{"doc": sent})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var received document
+	_, err = DecodeFunctionCallInto(data, options, map[string]any{"doc": &received})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sent.private = ""
+	if !reflect.DeepEqual(received, sent) {
+		t.Fatalf("expected: %#v, got: %#v", sent, received)
+	}
+
+	var flat struct {
+		Created int64
+		Owner   string
+		Title   string
+	}
+	_, err = DecodeFunctionCallInto(data, options, map[string]any{"doc": &flat})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if flat.Created != 1 || flat.Owner != "moin" || flat.Title != "dikka" {
+		t.Fatalf("expected flattened fields, got: %#v", flat)
+	}
+
+	_, err = DecodeFunctionCallInto(data, Options(ErrorOnUnexportedFields(true)), map[string]any{"doc": &received})
+	var unexported *UnexportedFieldError
+	if !errors.As(err, &unexported) {
+		t.Fatalf("expected UnexportedFieldError, got: %v", err)
+	}
+	type audit struct {
+		Created int64
+		editor  string
+	}
+	var embedded struct {
+		audit
+		Title string
+	}
+	_, err = DecodeFunctionCallInto(data, Options(ErrorOnUnexportedFields(true)), map[string]any{"doc": &embedded})
+	if !errors.As(err, &unexported) || unexported.Field != "audit.editor" {
+		t.Fatalf("expected UnexportedFieldError for audit.editor, got: %v", err)
+	}
+}
+
+func TestDecodeIntoTimeAndDuration(t *testing.T) {
+	type schedule struct {
+		Deadline time.Time
+		Start    *time.Time
+		Interval time.Duration
+		Timeout  int64
+	}
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	sent := schedule{
+		Deadline: time.Date(2024, 12, 24, 18, 0, 0, 42, time.UTC),
+		Start:    &start,
+		Interval: 15 * time.Minute,
+	}
+
+	options := Options()
+	data, err := EncodeFunctionCall("schedule", options, map[string]any{
+		"job":     sent,
+		"timeout": 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var target struct {
+		Job     schedule `protocol:"job"`
+		Timeout int64    `protocol:"timeout"`
+	}
+	_, err = DecodeFunctionCallInto(data, options, &target)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(target.Job, sent) {
+		t.Fatalf("expected: %#v, got: %#v", sent, target.Job)
+	}
+	if target.Timeout != int64(5*time.Second) {
+		t.Fatalf("expected %d, got %d", int64(5*time.Second), target.Timeout)
+	}
+}
+
+func TestDecodeIntoBytes(t *testing.T) {
+	type chunk struct {
+		Offset int64
+		Data   []byte
+		Hash   [4]byte
+	}
+
+	sent := chunk{Offset: 1024, Data: bytes.Repeat([]byte{0xAB}, 4096), Hash: [4]byte{0xDE, 0xAD, 0xBE, 0xEF}}
+
+	options := Options()
+	data, err := EncodeFunctionCall("upload", options, map[string]any{"chunk": sent})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(data) > len(sent.Data)+128 {
+		t.Fatalf("expected compact encoding, got %d bytes for %d bytes of data", len(data), len(sent.Data))
+	}
+
+	var received chunk
+	_, err = DecodeFunctionCallInto(data, options, map[string]any{"chunk": &received})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(received, sent) {
+		t.Fatalf("expected: %#v, got: %#v", sent, received)
+	}
+}
+
+func TestDecodeIntoPackedSlice(t *testing.T) {
+	type samples struct {
+		Values  []float64
+		Counts  []int
+		Flags   [3]bool
+		Offsets []any
+	}
+
+	options := Options()
+	data, err := EncodeFunctionCall("telemetry", options, map[string]any{
+		"samples": struct {
+			Values  []float64
+			Counts  []int32
+			Flags   []bool
+			Offsets []int8
+		}{
+			Values:  []float64{0.5, 1.5},
+			Counts:  []int32{1, -1},
+			Flags:   []bool{true, false, true, true},
+			Offsets: []int8{-3},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var received samples
+	_, err = DecodeFunctionCallInto(data, options, map[string]any{"samples": &received})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := samples{
+		Values:  []float64{0.5, 1.5},
+		Counts:  []int{1, -1},
+		Flags:   [3]bool{true, false, true},
+		Offsets: []any{int8(-3)},
+	}
+	if !reflect.DeepEqual(received, expected) {
+		t.Fatalf("expected: %#v, got: %#v", expected, received)
+	}
+
+	var narrow struct{ Counts []uint8 }
+	_, err = DecodeFunctionCallInto(data, options, map[string]any{"samples": &narrow})
+	var overflow *OverflowError
+	if !errors.As(err, &overflow) || overflow.Path != "samples.Counts[1]" {
+		t.Fatalf("expected OverflowError at samples.Counts[1], got: %v", err)
+	}
+}
+
+func TestDecodeArrayMapKeys(t *testing.T) {
+	hashes := map[[4]byte]string{{1, 2, 3, 4}: "x"}
+	pairs := map[[2]int32]string{{1, -2}: "y"}
+
+	options := Options()
+	data, err := EncodeFunctionCall("keys", options, map[string]any{"hashes": hashes, "pairs": pairs})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, args, err := DecodeFunctionCall(data, options)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(args["hashes"].Value, hashes) {
+		t.Fatalf("expected: %#v, got: %#v", hashes, args["hashes"].Value)
+	}
+	if !reflect.DeepEqual(args["pairs"].Value, pairs) {
+		t.Fatalf("expected: %#v, got: %#v", pairs, args["pairs"].Value)
+	}
+
+	var receivedHashes map[[4]byte]string
+	var receivedPairs map[[2]int32]string
+	_, err = DecodeFunctionCallInto(data, options, map[string]any{"hashes": &receivedHashes, "pairs": &receivedPairs})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(receivedHashes, hashes) || !reflect.DeepEqual(receivedPairs, pairs) {
+		t.Fatalf("expected: %#v and %#v, got: %#v and %#v", hashes, pairs, receivedHashes, receivedPairs)
+	}
+}
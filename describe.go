@@ -0,0 +1,247 @@
+package protocol
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const DescribeFunction = "__describe"
+
+type ServiceDescription struct {
+	Version    uint8
+	Subversion uint8
+	Functions  []FunctionDescription `protocol:",omitempty"`
+	Types      []StructDescription   `protocol:",omitempty"`
+}
+
+type FunctionDescription struct {
+	Name      string
+	Arguments []ArgumentDescription `protocol:",omitempty"`
+	Results   []TypeDescription     `protocol:",omitempty"`
+}
+
+type ArgumentDescription struct {
+	Name string
+	Type TypeDescription
+}
+
+// StructDescription lists the fields of a struct type once. Struct types
+// elsewhere in the description only refer to it by name, so deeply nested
+// types do not nest the description itself.
+type StructDescription struct {
+	Name   string
+	Fields []ArgumentDescription `protocol:",omitempty"`
+}
+
+type TypeDescription struct {
+	Type string
+	Name string           `protocol:",omitempty"`
+	Key  *TypeDescription `protocol:",omitempty"`
+	Elem *TypeDescription `protocol:",omitempty"`
+}
+
+func (c *Client) Describe(ctx context.Context) (*ServiceDescription, error) {
+	results, err := c.Call(ctx, DescribeFunction, nil)
+	if err != nil {
+		return nil, err
+	}
+	result, ok := results[resultName(0)]
+	if !ok {
+		return nil, &MissingArgumentError{Function: DescribeFunction, Argument: resultName(0)}
+	}
+
+	description := &ServiceDescription{}
+	err = result.DecodeInto(description)
+	if err != nil {
+		return nil, err
+	}
+	return description, nil
+}
+
+func (s *Server) describe() (ServiceDescription, error) {
+	description := ServiceDescription{
+		Version:    s.options.version,
+		Subversion: s.options.subversion,
+	}
+
+	s.mu.RLock()
+	functions := make([]*function, 0, len(s.functions))
+	for name, f := range s.functions {
+		if name == DescribeFunction {
+			continue
+		}
+		functions = append(functions, f)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(functions, func(i, j int) bool {
+		return functions[i].name < functions[j].name
+	})
+	types := newTypeTable()
+	for _, f := range functions {
+		description.Functions = append(description.Functions, f.describe(types))
+	}
+
+	description.Types = types.structs
+	sort.Slice(description.Types, func(i, j int) bool {
+		return description.Types[i].Name < description.Types[j].Name
+	})
+	return description, nil
+}
+
+func (f *function) describe(types *typeTable) FunctionDescription {
+	description := FunctionDescription{Name: f.name}
+	for i, param := range f.params() {
+		description.Arguments = append(description.Arguments, ArgumentDescription{
+			Name: f.argNames[i],
+			Type: types.describe(param),
+		})
+	}
+	for _, result := range f.results() {
+		description.Results = append(description.Results, types.describe(result))
+	}
+	return description
+}
+
+type typeTable struct {
+	names   map[reflect.Type]string
+	taken   map[string]bool
+	structs []StructDescription
+}
+
+func newTypeTable() *typeTable {
+	return &typeTable{
+		names: make(map[reflect.Type]string),
+		taken: make(map[string]bool),
+	}
+}
+
+func (types *typeTable) describe(t reflect.Type) TypeDescription {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Interface {
+		return TypeDescription{Type: "any"}
+	}
+
+	typeTag, ok := TypeToTypeTag(t)
+	if !ok {
+		return TypeDescription{Type: "unsupported " + t.Kind().String()}
+	}
+	description := TypeDescription{Type: TypeToString[typeTag]}
+	if _, ok := builtinTypeTags[t]; ok {
+		return description
+	}
+	if _, ok := marshalerTypeTag(t); ok {
+		description.Name = t.Name()
+		return description
+	}
+
+	switch typeTag {
+	case TypeStruct:
+		description.Name = types.describeStruct(t)
+	case TypeSlice, TypePackedSlice:
+		elem := types.describe(t.Elem())
+		description.Elem = &elem
+	case TypeMap, TypeMapStringKey:
+		key := types.describe(t.Key())
+		elem := types.describe(t.Elem())
+		description.Key = &key
+		description.Elem = &elem
+	}
+	return description
+}
+
+// describeStruct adds t to the table the first time it is seen and returns
+// the name it is listed under. Anonymous structs and types whose name is
+// already taken by another type are listed under their full type string.
+func (types *typeTable) describeStruct(t reflect.Type) string {
+	if name, ok := types.names[t]; ok {
+		return name
+	}
+
+	name := t.Name()
+	if name == "" || types.taken[name] {
+		name = t.String()
+	}
+	types.names[t] = name
+	types.taken[name] = true
+
+	i := len(types.structs)
+	types.structs = append(types.structs, StructDescription{Name: name})
+	var fields []ArgumentDescription
+	for _, field := range cachedStructFields(t).list {
+		fields = append(fields, ArgumentDescription{
+			Name: field.name,
+			Type: types.describe(t.FieldByIndex(field.index).Type),
+		})
+	}
+	types.structs[i].Fields = fields
+	return name
+}
+
+func (d *ServiceDescription) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "protocol version %d.%d\n", d.Version, d.Subversion)
+	for _, function := range d.Functions {
+		b.WriteString(function.String())
+		b.WriteByte('\n')
+	}
+	for _, structType := range d.Types {
+		b.WriteString(structType.String())
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func (d FunctionDescription) String() string {
+	arguments := make([]string, len(d.Arguments))
+	for i, argument := range d.Arguments {
+		arguments[i] = argument.String()
+	}
+	results := make([]string, len(d.Results))
+	for i, result := range d.Results {
+		results[i] = result.String()
+	}
+
+	s := fmt.Sprintf("%s(%s)", d.Name, strings.Join(arguments, ", "))
+	switch len(results) {
+	case 0:
+		return s
+	case 1:
+		return s + " " + results[0]
+	}
+	return fmt.Sprintf("%s (%s)", s, strings.Join(results, ", "))
+}
+
+func (d ArgumentDescription) String() string {
+	return d.Name + " " + d.Type.String()
+}
+
+func (d StructDescription) String() string {
+	if len(d.Fields) == 0 {
+		return fmt.Sprintf("type %s struct {}", d.Name)
+	}
+	fields := make([]string, len(d.Fields))
+	for i, field := range d.Fields {
+		fields[i] = field.String()
+	}
+	return fmt.Sprintf("type %s struct { %s }", d.Name, strings.Join(fields, "; "))
+}
+
+func (d TypeDescription) String() string {
+	switch {
+	case d.Key != nil && d.Elem != nil:
+		return fmt.Sprintf("map[%s]%s", d.Key, d.Elem)
+	case d.Elem != nil:
+		return "[]" + d.Elem.String()
+	case d.Type == TypeToString[TypeStruct] && d.Name != "":
+		return d.Name
+	case d.Name != "":
+		return fmt.Sprintf("%s (%s)", d.Name, d.Type)
+	}
+	return d.Type
+}
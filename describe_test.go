@@ -0,0 +1,129 @@
+package protocol
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testNode struct {
+	Value    string
+	Children []testNode
+}
+
+func TestClientDescribe(t *testing.T) {
+	type point struct {
+		X, Y   int
+		hidden bool
+	}
+
+	server := NewServer(Options(Subversion(3)))
+	_ = server.Register("move", func(ctx context.Context, p *point, dx int8) (point, error) { return *p, nil }, "point", "dx")
+	_ = server.Register("schedule", func(at time.Time, every time.Duration, tags map[string][]float64) {}, "at", "every", "tags")
+	_ = server.Register("tree", func(root testNode, ip net.IP, value any) (map[int]string, []byte) { return nil, nil }, "root", "ip", "value")
+	client, _ := newTestClient(t, server)
+
+	description, err := client.Describe(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	pointDescription := TypeDescription{Type: "struct", Name: "point"}
+	expected := &ServiceDescription{
+		Version:    1,
+		Subversion: 3,
+		Functions: []FunctionDescription{
+			{
+				Name: "move",
+				Arguments: []ArgumentDescription{
+					{Name: "point", Type: pointDescription},
+					{Name: "dx", Type: TypeDescription{Type: "int8"}},
+				},
+				Results: []TypeDescription{pointDescription},
+			},
+			{
+				Name: "schedule",
+				Arguments: []ArgumentDescription{
+					{Name: "at", Type: TypeDescription{Type: "time"}},
+					{Name: "every", Type: TypeDescription{Type: "duration"}},
+					{Name: "tags", Type: TypeDescription{
+						Type: "map[string]",
+						Key:  &TypeDescription{Type: "string"},
+						Elem: &TypeDescription{Type: "packed slice", Elem: &TypeDescription{Type: "float64"}},
+					}},
+				},
+			},
+			{
+				Name: "tree",
+				Arguments: []ArgumentDescription{
+					{Name: "root", Type: TypeDescription{Type: "struct", Name: "testNode"}},
+					{Name: "ip", Type: TypeDescription{Type: "string", Name: "IP"}},
+					{Name: "value", Type: TypeDescription{Type: "any"}},
+				},
+				Results: []TypeDescription{
+					{Type: "map", Key: &TypeDescription{Type: "int"}, Elem: &TypeDescription{Type: "string"}},
+					{Type: "bytes"},
+				},
+			},
+		},
+		Types: []StructDescription{
+			{Name: "point", Fields: []ArgumentDescription{
+				{Name: "X", Type: TypeDescription{Type: "int"}},
+				{Name: "Y", Type: TypeDescription{Type: "int"}},
+			}},
+			{Name: "testNode", Fields: []ArgumentDescription{
+				{Name: "Value", Type: TypeDescription{Type: "string"}},
+				{Name: "Children", Type: TypeDescription{Type: "slice", Elem: &TypeDescription{Type: "struct", Name: "testNode"}}},
+			}},
+		},
+	}
+	if !reflect.DeepEqual(description, expected) {
+		t.Fatalf("expected %#v, got %#v", expected, description)
+	}
+
+	expectedString := `protocol version 1.3
+move(point point, dx int8) point
+schedule(at time, every duration, tags map[string][]float64)
+tree(root testNode, ip IP (string), value any) (map[int]string, bytes)
+type point struct { X int; Y int }
+type testNode struct { Value string; Children []testNode }
+`
+	if description.String() != expectedString {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expectedString, description.String())
+	}
+
+	err = server.Register(DescribeFunction, func() {})
+	if err == nil {
+		t.Fatalf("expected error for reserved function name")
+	}
+}
+
+func TestClientDescribeDeepTypes(t *testing.T) {
+	deep := reflect.TypeOf(0)
+	for i := 0; i < 40; i++ {
+		deep = reflect.StructOf([]reflect.StructField{{Name: "Next", Type: deep}})
+	}
+	fn := reflect.MakeFunc(reflect.FuncOf([]reflect.Type{deep}, nil, false), func([]reflect.Value) []reflect.Value {
+		return nil
+	})
+
+	server := NewServer(Options())
+	err := server.Register("deep", fn.Interface(), "root")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	client, _ := newTestClient(t, server)
+
+	description, err := client.Describe(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(description.Types) != 40 {
+		t.Fatalf("expected 40 struct types, got %d", len(description.Types))
+	}
+	if description.Functions[0].Arguments[0].Type.Name != deep.String() {
+		t.Fatalf("expected argument to refer to %q, got %q", deep.String(), description.Functions[0].Arguments[0].Type.Name)
+	}
+}
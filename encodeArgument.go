@@ -2,21 +2,60 @@ package protocol
 
 import (
 	"bytes"
+	"cmp"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"reflect"
 	"sort"
+	"time"
 )
 
 func encodeArgument(writeBuf *bytes.Buffer, value any, name string) error {
+	return encodeArgumentWithOptions(writeBuf, value, name, Options())
+}
+
+func encodeArgumentWithOptions(writeBuf *bytes.Buffer, value any, name string, options *options) error {
+	return encodeValue(writeBuf, value, name, name, 1, options)
+}
+
+func encodeValue(writeBuf *bytes.Buffer, value any, name string, path string, depth int, options *options) (err error) {
+	defer func() {
+		err = encodingError(err, path)
+	}()
+
+	if depth > options.maxDepthOrDefault() {
+		return &LimitExceededError{Limit: "depth", Path: path, Value: depth, Max: options.maxDepthOrDefault()}
+	}
+
+	algorithm, err := checksumByID(options.checksumAlgorithm)
+	if err != nil {
+		return err
+	}
+	topLevel, nestedChecksum, err := argumentChecksums(algorithm, options.argumentChecksums)
+	if err != nil {
+		return err
+	}
+	if depth > 1 {
+		algorithm = nestedChecksum
+	} else {
+		algorithm = topLevel
+	}
+
 	buf := bytes.NewBuffer(nil)
 
 	typeTag, ok := AnyToTypeTag(value)
 	if !ok {
-		return &UnsupportedTypeError{Kind: reflect.TypeOf(value).Kind()}
+		return &UnsupportedTypeError{Kind: reflect.TypeOf(indirect(value)).Kind()}
+	}
+
+	marshaled, isMarshaled, err := marshalValue(value)
+	if err != nil {
+		return err
 	}
+	value = indirect(value)
 
-	err := buf.WriteByte(typeTag)
+	err = buf.WriteByte(typeTag)
 	if err != nil {
 		return err
 	}
@@ -27,7 +66,9 @@ func encodeArgument(writeBuf *bytes.Buffer, value any, name string) error {
 	}
 
 	var content []byte
-	if isFixedType(typeTag) {
+	if isMarshaled {
+		content = marshaled
+	} else if isFixedType(typeTag) {
 		contentBuffer := bytes.NewBuffer(nil)
 		err = binary.Write(contentBuffer, binary.BigEndian, value)
 		if err != nil {
@@ -38,7 +79,7 @@ func encodeArgument(writeBuf *bytes.Buffer, value any, name string) error {
 		switch typeTag {
 		case TypeInt:
 			contentBuffer := bytes.NewBuffer(nil)
-			as64 := int64(value.(int))
+			as64 := reflect.ValueOf(value).Int()
 			err = binary.Write(contentBuffer, binary.BigEndian, as64)
 			if err != nil {
 				return err
@@ -46,24 +87,43 @@ func encodeArgument(writeBuf *bytes.Buffer, value any, name string) error {
 			content = contentBuffer.Bytes()
 		case TypeUInt:
 			contentBuffer := bytes.NewBuffer(nil)
-			as64 := uint64(value.(uint))
+			as64 := reflect.ValueOf(value).Uint()
 			err = binary.Write(contentBuffer, binary.BigEndian, as64)
 			if err != nil {
 				return err
 			}
 			content = contentBuffer.Bytes()
 		case TypeString:
-			content = []byte(value.(string))
+			content = []byte(reflect.ValueOf(value).String())
+		case TypeNil:
+			content = nil
+		case TypeBytes:
+			content = byteSequence(reflect.ValueOf(value))
+		case TypePackedSlice:
+			content, err = encodePackedSlice(reflect.ValueOf(value))
+			if err != nil {
+				return err
+			}
+		case TypeTime:
+			content = encodeTime(value.(time.Time))
+		case TypeDuration:
+			content = binary.BigEndian.AppendUint64(nil, uint64(value.(time.Duration)))
 		case TypeStruct:
 			contentBuffer := bytes.NewBuffer(nil)
-			t := reflect.ValueOf(value).Type()
-			for i := 0; i < t.NumField(); i++ {
-				field := t.Field(i)
-				fieldValue := reflect.ValueOf(value).Field(i).Interface()
+			structValue := reflect.ValueOf(value)
+			fields := cachedStructFields(structValue.Type())
+			if options.errorOnUnexportedFields && len(fields.unexported) > 0 {
+				return &UnexportedFieldError{Type: structValue.Type(), Field: fields.unexported[0]}
+			}
+			for _, field := range fields.list {
+				fieldValue, ok := fieldByIndex(structValue, field.index)
+				if !ok || field.omitEmpty && isEmptyValue(fieldValue) {
+					continue
+				}
 
 				tmpBuf := bytes.NewBuffer(nil)
 
-				err := encodeArgument(tmpBuf, fieldValue, field.Name)
+				err := encodeValue(tmpBuf, fieldValue.Interface(), field.name, childPath(path, field.name), depth+1, options)
 				if err != nil {
 					return err
 				}
@@ -80,7 +140,7 @@ func encodeArgument(writeBuf *bytes.Buffer, value any, name string) error {
 				tmpBuf := bytes.NewBuffer(nil)
 
 				element := reflect.ValueOf(value).Index(i).Interface()
-				err := encodeArgument(tmpBuf, element, "")
+				err := encodeValue(tmpBuf, element, "", fmt.Sprintf("%s[%d]", path, i), depth+1, options)
 				if err != nil {
 					return err
 				}
@@ -93,16 +153,14 @@ func encodeArgument(writeBuf *bytes.Buffer, value any, name string) error {
 			content = contentBuffer.Bytes()
 		case TypeMapStringKey:
 			contentBuffer := bytes.NewBuffer(nil)
-			m := map[string]any(value.(map[string]any))
-			keys := make([]string, 0, len(m))
-			for key := range m {
-				keys = append(keys, key)
-			}
-			sort.Strings(keys)
-			for _, key := range keys {
+			entries := mapEntries(reflect.ValueOf(value))
+			sort.Slice(entries, func(i, j int) bool {
+				return entries[i].key.String() < entries[j].key.String()
+			})
+			for _, entry := range entries {
 				tmpBuf := bytes.NewBuffer(nil)
 
-				err := encodeArgument(tmpBuf, m[key], key)
+				err := encodeValue(tmpBuf, entry.value.Interface(), entry.key.String(), fmt.Sprintf("%s[%q]", path, entry.key.String()), depth+1, options)
 				if err != nil {
 					return err
 				}
@@ -115,19 +173,18 @@ func encodeArgument(writeBuf *bytes.Buffer, value any, name string) error {
 			content = contentBuffer.Bytes()
 		case TypeMap:
 			contentBuffer := bytes.NewBuffer(nil)
-			m := map[any]any(value.(map[any]any))
-			keys := make([]any, 0, len(m))
-			for key := range m {
-				keys = append(keys, key)
-			}
-			sort.Slice(keys, func(i, j int) bool {
-				return fmt.Sprintf("%v", keys[i]) < fmt.Sprintf("%v", keys[j])
+			entries := mapEntries(reflect.ValueOf(value))
+			sort.SliceStable(entries, func(i, j int) bool {
+				if c := compareMapKeys(entries[i].key.Interface(), entries[j].key.Interface()); c != 0 {
+					return c < 0
+				}
+				return compareMapKeys(entries[i].value.Interface(), entries[j].value.Interface()) < 0
 			})
 
-			for _, key := range keys {
+			for i, entry := range entries {
 				tmpBuf := bytes.NewBuffer(nil)
 
-				err := encodeArgument(tmpBuf, key, "")
+				err := encodeValue(tmpBuf, entry.key.Interface(), "", fmt.Sprintf("%s.keys[%d]", path, i), depth+1, options)
 				if err != nil {
 					return err
 				}
@@ -139,7 +196,7 @@ func encodeArgument(writeBuf *bytes.Buffer, value any, name string) error {
 
 				tmpBuf = bytes.NewBuffer(nil)
 
-				err = encodeArgument(tmpBuf, m[key], "")
+				err = encodeValue(tmpBuf, entry.value.Interface(), "", fmt.Sprintf("%s[%v]", path, entry.key.Interface()), depth+1, options)
 				if err != nil {
 					return err
 				}
@@ -188,7 +245,7 @@ func encodeArgument(writeBuf *bytes.Buffer, value any, name string) error {
 		return err
 	}
 
-	err = writeChecksum(buf)
+	err = writeChecksum(buf, algorithm)
 	if err != nil {
 		return err
 	}
@@ -200,3 +257,98 @@ func encodeArgument(writeBuf *bytes.Buffer, value any, name string) error {
 
 	return nil
 }
+
+func childPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func encodingError(err error, path string) error {
+	var encodingErr *EncodingError
+	if err == nil || errors.As(err, &encodingErr) {
+		return err
+	}
+	return &EncodingError{Path: path, err: err}
+}
+
+func byteSequence(value reflect.Value) []byte {
+	if b, ok := value.Interface().([]byte); ok {
+		return b
+	}
+
+	content := make([]byte, value.Len())
+	for i := range content {
+		content[i] = byte(value.Index(i).Uint())
+	}
+	return content
+}
+
+type mapEntry struct {
+	key   reflect.Value
+	value reflect.Value
+}
+
+// mapEntries collects the entries of m through MapRange, as MapIndex cannot
+// look up keys that are not equal to themselves, such as NaN.
+func mapEntries(m reflect.Value) []mapEntry {
+	entries := make([]mapEntry, 0, m.Len())
+	iter := m.MapRange()
+	for iter.Next() {
+		entries = append(entries, mapEntry{key: iter.Key(), value: iter.Value()})
+	}
+	return entries
+}
+
+func indirect(value any) any {
+	reflectValue := reflect.ValueOf(value)
+	if reflectValue.Kind() != reflect.Ptr || reflectValue.IsNil() || isRecursivePointer(reflectValue.Type()) {
+		return value
+	}
+	for reflectValue.Kind() == reflect.Ptr && !reflectValue.IsNil() {
+		reflectValue = reflectValue.Elem()
+	}
+	return reflectValue.Interface()
+}
+
+func compareMapKeys(a, b any) int {
+	a, b = indirect(a), indirect(b)
+	aTag, _ := AnyToTypeTag(a)
+	bTag, _ := AnyToTypeTag(b)
+	if aTag != bTag {
+		return cmp.Compare(aTag, bTag)
+	}
+
+	aValue, bValue := reflect.ValueOf(a), reflect.ValueOf(b)
+	switch {
+	case aTag == TypeNil:
+		return 0
+	case isIntKind(aValue.Kind()):
+		return cmp.Compare(aValue.Int(), bValue.Int())
+	case isUintKind(aValue.Kind()):
+		return cmp.Compare(aValue.Uint(), bValue.Uint())
+	case isFloatKind(aValue.Kind()):
+		return cmp.Compare(aValue.Float(), bValue.Float())
+	case isComplexKind(aValue.Kind()):
+		if c := cmp.Compare(real(aValue.Complex()), real(bValue.Complex())); c != 0 {
+			return c
+		}
+		return cmp.Compare(imag(aValue.Complex()), imag(bValue.Complex()))
+	case aValue.Kind() == reflect.String:
+		return cmp.Compare(aValue.String(), bValue.String())
+	case aValue.Kind() == reflect.Bool:
+		if aValue.Bool() == bValue.Bool() {
+			return 0
+		}
+		if bValue.Bool() {
+			return -1
+		}
+		return 1
+	}
+
+	aBuf, bBuf := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
+	_ = encodeArgument(aBuf, a, "")
+	_ = encodeArgument(bBuf, b, "")
+	return bytes.Compare(aBuf.Bytes(), bBuf.Bytes())
+}
@@ -2,8 +2,11 @@ package protocol
 
 import (
 	"bytes"
+	"errors"
 	"math"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestEncodeFixedArgument(t *testing.T) {
@@ -43,7 +46,7 @@ func TestEncodeFixedArgument(t *testing.T) {
 			}
 
 			resultBuf := bytes.NewBuffer(tt.result)
-			err = writeChecksum(resultBuf)
+			err = writeChecksum(resultBuf, checksums[ChecksumCRC32])
 			if err != nil {
 				t.Fatalf("error writing checksum: %v", err)
 			}
@@ -83,7 +86,7 @@ got:      %s
 // 			}
 
 // 			resultBuf := bytes.NewBuffer(tt.result)
-// 			err = writeChecksum(resultBuf)
+// 			err = writeChecksum(resultBuf, checksums[ChecksumCRC32])
 // 			if err != nil {
 // 				t.Fatalf("error writing checksum: %v", err)
 // 			}
@@ -139,7 +142,7 @@ func TestEncodeDynamicIntArgument(t *testing.T) {
 			}
 
 			resultBuf := bytes.NewBuffer(tt.result)
-			err = writeChecksum(resultBuf)
+			err = writeChecksum(resultBuf, checksums[ChecksumCRC32])
 			if err != nil {
 				t.Fatalf("error writing checksum: %v", err)
 			}
@@ -184,7 +187,7 @@ func TestEncodeStringArgument(t *testing.T) {
 			}
 
 			resultBuf := bytes.NewBuffer(tt.result)
-			err = writeChecksum(resultBuf)
+			err = writeChecksum(resultBuf, checksums[ChecksumCRC32])
 			if err != nil {
 				t.Fatalf("error writing checksum: %v", err)
 			}
@@ -250,7 +253,7 @@ func TestEncodeStructArgument(t *testing.T) {
 			innerBuf := bytes.NewBuffer(nil)
 			for _, innerResult := range tt.innerResults {
 				tmpBuf := bytes.NewBuffer(innerResult)
-				err = writeChecksum(tmpBuf)
+				err = writeChecksum(tmpBuf, checksums[ChecksumCRC32])
 				if err != nil {
 					t.Fatalf("error writing checksum: %v", err)
 				}
@@ -260,7 +263,7 @@ func TestEncodeStructArgument(t *testing.T) {
 			resultBuf := bytes.NewBuffer(tt.outerResult)
 			resultBuf.Write(innerBuf.Bytes())
 
-			err = writeChecksum(resultBuf)
+			err = writeChecksum(resultBuf, checksums[ChecksumCRC32])
 			if err != nil {
 				t.Fatalf("error writing checksum: %v", err)
 			}
@@ -293,7 +296,7 @@ func TestEncodeNestedStruct(t *testing.T) {
 	innerContentExpected := bytes.NewBuffer([]byte{
 		TypeUInt8, 'B', 'y', 't', 'e', 0xFF, 0x01, 0x01, 0xDE,
 	})
-	err := writeChecksum(innerContentExpected)
+	err := writeChecksum(innerContentExpected, checksums[ChecksumCRC32])
 	if err != nil {
 		t.Fatalf("error writing checksum: %v", err)
 	}
@@ -302,7 +305,7 @@ func TestEncodeNestedStruct(t *testing.T) {
 		TypeStruct, 'I', 'n', 'n', 'e', 'r', 0xFF, 0x01, byte(innerContentExpected.Len()),
 	})
 	innerExpected.Write(innerContentExpected.Bytes())
-	err = writeChecksum(innerExpected)
+	err = writeChecksum(innerExpected, checksums[ChecksumCRC32])
 	if err != nil {
 		return
 	}
@@ -311,7 +314,7 @@ func TestEncodeNestedStruct(t *testing.T) {
 		TypeStruct, 'n', 'e', 's', 't', 'e', 'd', 0xFF, 0x01, byte(innerExpected.Len()),
 	})
 	outerExpected.Write(innerExpected.Bytes())
-	err = writeChecksum(outerExpected)
+	err = writeChecksum(outerExpected, checksums[ChecksumCRC32])
 	if err != nil {
 		return
 	}
@@ -340,7 +343,7 @@ func TestEncodeSlice(t *testing.T) {
 		innerResults [][]byte
 		expectErr    bool
 	}{
-		{"primitives", []byte{0xDE, 0x68, 0xAA}, []byte{
+		{"primitives", []any{byte(0xDE), byte(0x68), byte(0xAA)}, []byte{
 			TypeSlice, 'p', 'r', 'i', 'm', 'i', 't', 'i', 'v', 'e', 's', 0xFF, 0x01, 0x1B,
 		}, [][]byte{
 			{
@@ -377,7 +380,7 @@ func TestEncodeSlice(t *testing.T) {
 			innerBuf := bytes.NewBuffer(nil)
 			for _, innerResult := range tt.innerResults {
 				tmpBuf := bytes.NewBuffer(innerResult)
-				err = writeChecksum(tmpBuf)
+				err = writeChecksum(tmpBuf, checksums[ChecksumCRC32])
 				if err != nil {
 					t.Fatalf("error writing checksum: %v", err)
 				}
@@ -387,7 +390,7 @@ func TestEncodeSlice(t *testing.T) {
 			resultBuf := bytes.NewBuffer(tt.outerResult)
 			resultBuf.Write(innerBuf.Bytes())
 
-			err = writeChecksum(resultBuf)
+			err = writeChecksum(resultBuf, checksums[ChecksumCRC32])
 			if err != nil {
 				t.Fatalf("error writing checksum: %v", err)
 			}
@@ -405,9 +408,9 @@ got:
 }
 
 func TestEncodeNestedSlice(t *testing.T) {
-	inner1 := []byte{0xDE, 0x68}
-	inner2 := []byte{0xAA}
-	value := [][]byte{
+	inner1 := []any{byte(0xDE), byte(0x68)}
+	inner2 := []any{byte(0xAA)}
+	value := [][]any{
 		inner1,
 		inner2,
 	}
@@ -415,14 +418,14 @@ func TestEncodeNestedSlice(t *testing.T) {
 	inner1ContentExpectedA := bytes.NewBuffer([]byte{
 		TypeUInt8, 0xFF, 0x01, 0x01, 0xDE,
 	})
-	err := writeChecksum(inner1ContentExpectedA)
+	err := writeChecksum(inner1ContentExpectedA, checksums[ChecksumCRC32])
 	if err != nil {
 		t.Fatalf("error writing checksum: %v", err)
 	}
 	inner1ContentExpectedB := bytes.NewBuffer([]byte{
 		TypeUInt8, 0xFF, 0x01, 0x01, 0x68,
 	})
-	err = writeChecksum(inner1ContentExpectedB)
+	err = writeChecksum(inner1ContentExpectedB, checksums[ChecksumCRC32])
 	if err != nil {
 		t.Fatalf("error writing checksum: %v", err)
 	}
@@ -434,7 +437,7 @@ func TestEncodeNestedSlice(t *testing.T) {
 	})
 
 	inner1Expected.Write(inner1ContentExpected.Bytes())
-	err = writeChecksum(inner1Expected)
+	err = writeChecksum(inner1Expected, checksums[ChecksumCRC32])
 	if err != nil {
 		t.Fatalf("error writing checksum: %v", err)
 	}
@@ -442,7 +445,7 @@ func TestEncodeNestedSlice(t *testing.T) {
 	inner2ContentExpected := bytes.NewBuffer([]byte{
 		TypeUInt8, 0xFF, 0x01, 0x01, 0xAA,
 	})
-	err = writeChecksum(inner2ContentExpected)
+	err = writeChecksum(inner2ContentExpected, checksums[ChecksumCRC32])
 	if err != nil {
 		t.Fatalf("error writing checksum: %v", err)
 	}
@@ -451,7 +454,7 @@ func TestEncodeNestedSlice(t *testing.T) {
 	})
 
 	inner2Expected.Write(inner2ContentExpected.Bytes())
-	err = writeChecksum(inner2Expected)
+	err = writeChecksum(inner2Expected, checksums[ChecksumCRC32])
 	if err != nil {
 		t.Fatalf("error writing checksum: %v", err)
 	}
@@ -462,7 +465,7 @@ func TestEncodeNestedSlice(t *testing.T) {
 	})
 	outerExpected.Write(inner1Expected.Bytes())
 	outerExpected.Write(inner2Expected.Bytes())
-	err = writeChecksum(outerExpected)
+	err = writeChecksum(outerExpected, checksums[ChecksumCRC32])
 	if err != nil {
 		t.Fatalf("error writing checksum: %v", err)
 	}
@@ -521,7 +524,7 @@ func TestEncodeMapStringKeyArgument(t *testing.T) {
 			innerBuf := bytes.NewBuffer(nil)
 			for _, innerResult := range tt.innerResults {
 				tmpBuf := bytes.NewBuffer(innerResult)
-				err = writeChecksum(tmpBuf)
+				err = writeChecksum(tmpBuf, checksums[ChecksumCRC32])
 				if err != nil {
 					t.Fatalf("error writing checksum: %v", err)
 				}
@@ -533,7 +536,7 @@ func TestEncodeMapStringKeyArgument(t *testing.T) {
 			resultBuf.WriteByte(byte(innerBufSize))
 			resultBuf.Write(innerBuf.Bytes())
 
-			err = writeChecksum(resultBuf)
+			err = writeChecksum(resultBuf, checksums[ChecksumCRC32])
 			if err != nil {
 				t.Fatalf("error writing checksum: %v", err)
 			}
@@ -566,7 +569,7 @@ func TestEncodeNestedMapStringKeyArgument(t *testing.T) {
 	innerMap1ContentExpected := bytes.NewBuffer([]byte{
 		TypeUInt8, 'k', 'e', 'y', '1', 0xFF, 0x01, 0x01, 0xDE,
 	})
-	err := writeChecksum(innerMap1ContentExpected)
+	err := writeChecksum(innerMap1ContentExpected, checksums[ChecksumCRC32])
 	if err != nil {
 		t.Fatalf("error writing checksum: %v", err)
 	}
@@ -574,7 +577,7 @@ func TestEncodeNestedMapStringKeyArgument(t *testing.T) {
 	innerMap2ContentExpected := bytes.NewBuffer([]byte{
 		TypeUInt8, 'k', 'e', 'y', '2', 0xFF, 0x01, 0x01, 0x68,
 	})
-	err = writeChecksum(innerMap2ContentExpected)
+	err = writeChecksum(innerMap2ContentExpected, checksums[ChecksumCRC32])
 	if err != nil {
 		t.Fatalf("error writing checksum: %v", err)
 	}
@@ -583,7 +586,7 @@ func TestEncodeNestedMapStringKeyArgument(t *testing.T) {
 		TypeMapStringKey, 'o', 'u', 't', 'e', 'r', 'K', 'e', 'y', '1', 0xFF, 0x01, byte(innerMap1ContentExpected.Len()),
 	})
 	innerMap1Expected.Write(innerMap1ContentExpected.Bytes())
-	err = writeChecksum(innerMap1Expected)
+	err = writeChecksum(innerMap1Expected, checksums[ChecksumCRC32])
 	if err != nil {
 		t.Fatalf("error writing checksum: %v", err)
 	}
@@ -592,7 +595,7 @@ func TestEncodeNestedMapStringKeyArgument(t *testing.T) {
 		TypeMapStringKey, 'o', 'u', 't', 'e', 'r', 'K', 'e', 'y', '2', 0xFF, 0x01, byte(innerMap2ContentExpected.Len()),
 	})
 	innerMap2Expected.Write(innerMap2ContentExpected.Bytes())
-	err = writeChecksum(innerMap2Expected)
+	err = writeChecksum(innerMap2Expected, checksums[ChecksumCRC32])
 	if err != nil {
 		t.Fatalf("error writing checksum: %v", err)
 	}
@@ -603,7 +606,7 @@ func TestEncodeNestedMapStringKeyArgument(t *testing.T) {
 	outerExpected.WriteByte(byte(innerMap1Expected.Len() + innerMap2Expected.Len()))
 	outerExpected.Write(innerMap1Expected.Bytes())
 	outerExpected.Write(innerMap2Expected.Bytes())
-	err = writeChecksum(outerExpected)
+	err = writeChecksum(outerExpected, checksums[ChecksumCRC32])
 	if err != nil {
 		t.Fatalf("error writing checksum: %v", err)
 	}
@@ -669,7 +672,7 @@ func TestEncodeMap(t *testing.T) {
 			innerBuf := bytes.NewBuffer(nil)
 			for _, innerResult := range tt.innerResults {
 				tmpBuf := bytes.NewBuffer(innerResult)
-				err = writeChecksum(tmpBuf)
+				err = writeChecksum(tmpBuf, checksums[ChecksumCRC32])
 				if err != nil {
 					t.Fatalf("error writing checksum: %v", err)
 				}
@@ -681,7 +684,7 @@ func TestEncodeMap(t *testing.T) {
 			resultBuf.WriteByte(byte(innerBufSize))
 			resultBuf.Write(innerBuf.Bytes())
 
-			err = writeChecksum(resultBuf)
+			err = writeChecksum(resultBuf, checksums[ChecksumCRC32])
 			if err != nil {
 				t.Fatalf("error writing checksum: %v", err)
 			}
@@ -708,7 +711,7 @@ func TestEncodeNestedMap(t *testing.T) {
 	innerMapContentExpectedKey := bytes.NewBuffer([]byte{
 		TypeString, 0xFF, 0x01, 0x08, 'i', 'n', 'n', 'e', 'r', 'K', 'e', 'y',
 	})
-	err := writeChecksum(innerMapContentExpectedKey)
+	err := writeChecksum(innerMapContentExpectedKey, checksums[ChecksumCRC32])
 	if err != nil {
 		t.Fatalf("error writing checksum: %v", err)
 	}
@@ -716,7 +719,7 @@ func TestEncodeNestedMap(t *testing.T) {
 	innerMapContentExpectedValue := bytes.NewBuffer([]byte{
 		TypeUInt8, 0xFF, 0x01, 0x01, 0xDE,
 	})
-	err = writeChecksum(innerMapContentExpectedValue)
+	err = writeChecksum(innerMapContentExpectedValue, checksums[ChecksumCRC32])
 	if err != nil {
 		t.Fatalf("error writing checksum: %v", err)
 	}
@@ -730,13 +733,13 @@ func TestEncodeNestedMap(t *testing.T) {
 	outerMapContentExpectedKey := bytes.NewBuffer([]byte{
 		TypeString, 0xFF, 0x01, 0x08, 'o', 'u', 't', 'e', 'r', 'K', 'e', 'y',
 	})
-	err = writeChecksum(outerMapContentExpectedKey)
+	err = writeChecksum(outerMapContentExpectedKey, checksums[ChecksumCRC32])
 	if err != nil {
 		t.Fatalf("error writing checksum: %v", err)
 	}
 
 	outerMapContentExpectedValue := bytes.NewBuffer(innerMapExpected.Bytes())
-	err = writeChecksum(outerMapContentExpectedValue)
+	err = writeChecksum(outerMapContentExpectedValue, checksums[ChecksumCRC32])
 	if err != nil {
 		t.Fatalf("error writing checksum: %v", err)
 	}
@@ -746,7 +749,7 @@ func TestEncodeNestedMap(t *testing.T) {
 	})
 	outerMapExpected.Write(outerMapContentExpectedKey.Bytes())
 	outerMapExpected.Write(outerMapContentExpectedValue.Bytes())
-	err = writeChecksum(outerMapExpected)
+	err = writeChecksum(outerMapExpected, checksums[ChecksumCRC32])
 	if err != nil {
 		t.Fatalf("error writing checksum: %v", err)
 	}
@@ -764,3 +767,520 @@ diff
 		`, compareBytes(outerMapExpected.Bytes(), buf.Bytes()))
 	}
 }
+
+func TestEncodeStructTags(t *testing.T) {
+	type tagged struct {
+		Renamed  byte   `protocol:"renamed"`
+		Empty    string `protocol:",omitempty"`
+		Skipped  string `protocol:"-"`
+		Filled   string `protocol:"filled,omitempty"`
+		Untagged bool
+	}
+
+	value := tagged{
+		Renamed:  0xDE,
+		Skipped:  "secret",
+		Filled:   "moin",
+		Untagged: true,
+	}
+
+	innerResults := [][]byte{
+		{
+			TypeUInt8, 'r', 'e', 'n', 'a', 'm', 'e', 'd', 0xFF, 0x01, 0x01, 0xDE,
+		},
+		{
+			TypeString, 'f', 'i', 'l', 'l', 'e', 'd', 0xFF, 0x01, 0x04, 'm', 'o', 'i', 'n',
+		},
+		{
+			TypeBool, 'U', 'n', 't', 'a', 'g', 'g', 'e', 'd', 0xFF, 0x01, 0x01, 0x01,
+		},
+	}
+
+	innerBuf := bytes.NewBuffer(nil)
+	for _, innerResult := range innerResults {
+		tmpBuf := bytes.NewBuffer(innerResult)
+		err := writeChecksum(tmpBuf, checksums[ChecksumCRC32])
+		if err != nil {
+			t.Fatalf("error writing checksum: %v", err)
+		}
+		innerBuf.Write(tmpBuf.Bytes())
+	}
+
+	expected := bytes.NewBuffer([]byte{
+		TypeStruct, 't', 'a', 'g', 's', 0xFF, 0x01, byte(innerBuf.Len()),
+	})
+	expected.Write(innerBuf.Bytes())
+	err := writeChecksum(expected, checksums[ChecksumCRC32])
+	if err != nil {
+		t.Fatalf("error writing checksum: %v", err)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	err = encodeArgument(buf, value, "tags")
+	if err != nil {
+		t.Fatalf("error encoding argument: %v", err)
+	}
+
+	if !bytes.Equal(buf.Bytes(), expected.Bytes()) {
+		t.Fatalf(`
+diff
+%s
+		`, compareBytes(expected.Bytes(), buf.Bytes()))
+	}
+}
+
+func TestEncodePointerAndNil(t *testing.T) {
+	number := byte(0xDE)
+	pointer := &number
+	var nilPointer *byte
+	var nilSlice []byte
+	var nilMap map[string]any
+
+	tests := []struct {
+		name   string
+		value  any
+		result []byte
+	}{
+		{"pointer", pointer, []byte{
+			TypeUInt8, 'p', 'o', 'i', 'n', 't', 'e', 'r', 0xFF, 0x01, 0x01, 0xDE,
+		}},
+		{"double", &pointer, []byte{
+			TypeUInt8, 'd', 'o', 'u', 'b', 'l', 'e', 0xFF, 0x01, 0x01, 0xDE,
+		}},
+		{"nil", nil, []byte{
+			TypeNil, 'n', 'i', 'l', 0xFF, 0x01, 0x00,
+		}},
+		{"nilptr", nilPointer, []byte{
+			TypeNil, 'n', 'i', 'l', 'p', 't', 'r', 0xFF, 0x01, 0x00,
+		}},
+		{"nilslice", nilSlice, []byte{
+			TypeNil, 'n', 'i', 'l', 's', 'l', 'i', 'c', 'e', 0xFF, 0x01, 0x00,
+		}},
+		{"nilmap", nilMap, []byte{
+			TypeNil, 'n', 'i', 'l', 'm', 'a', 'p', 0xFF, 0x01, 0x00,
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := bytes.NewBuffer(nil)
+			err := encodeArgument(buf, tt.value, tt.name)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			resultBuf := bytes.NewBuffer(tt.result)
+			err = writeChecksum(resultBuf, checksums[ChecksumCRC32])
+			if err != nil {
+				t.Fatalf("error writing checksum: %v", err)
+			}
+
+			if !bytes.Equal(buf.Bytes(), resultBuf.Bytes()) {
+				t.Fatalf(`
+expected: %s
+got:      %s
+				`, bytesToHexString(resultBuf.Bytes()), bytesToHexString(buf.Bytes()))
+			}
+		})
+	}
+}
+
+func TestEncodeTypedMap(t *testing.T) {
+	tests := []struct {
+		name         string
+		value        any
+		outerResult  []byte
+		innerResults [][]byte
+	}{
+		{"ordered", map[int8]string{10: "b", -1: "a", 2: "c"}, []byte{
+			TypeMap, 'o', 'r', 'd', 'e', 'r', 'e', 'd', 0xFF, 0x01,
+		}, [][]byte{
+			{TypeInt8, 0xFF, 0x01, 0x01, 0xFF},
+			{TypeString, 0xFF, 0x01, 0x01, 'a'},
+			{TypeInt8, 0xFF, 0x01, 0x01, 0x02},
+			{TypeString, 0xFF, 0x01, 0x01, 'c'},
+			{TypeInt8, 0xFF, 0x01, 0x01, 0x0A},
+			{TypeString, 0xFF, 0x01, 0x01, 'b'},
+		}},
+		{"nan keys", map[float64]int{math.NaN(): 2, 1.5: 3, math.NaN(): 1}, []byte{
+			TypeMap, 'n', 'a', 'n', ' ', 'k', 'e', 'y', 's', 0xFF, 0x01,
+		}, [][]byte{
+			{TypeFloat64, 0xFF, 0x01, 0x08, 0x7F, 0xF8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01},
+			{TypeInt, 0xFF, 0x01, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01},
+			{TypeFloat64, 0xFF, 0x01, 0x08, 0x7F, 0xF8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01},
+			{TypeInt, 0xFF, 0x01, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02},
+			{TypeFloat64, 0xFF, 0x01, 0x08, 0x3F, 0xF8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+			{TypeInt, 0xFF, 0x01, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x03},
+		}},
+		{"string key", map[string]uint16{"moin": 0x1234}, []byte{
+			TypeMapStringKey, 's', 't', 'r', 'i', 'n', 'g', ' ', 'k', 'e', 'y', 0xFF, 0x01,
+		}, [][]byte{
+			{TypeUInt16, 'm', 'o', 'i', 'n', 0xFF, 0x01, 0x02, 0x12, 0x34},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := bytes.NewBuffer(nil)
+			err := encodeArgument(buf, tt.value, tt.name)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			innerBuf := bytes.NewBuffer(nil)
+			for _, innerResult := range tt.innerResults {
+				tmpBuf := bytes.NewBuffer(innerResult)
+				err = writeChecksum(tmpBuf, checksums[ChecksumCRC32])
+				if err != nil {
+					t.Fatalf("error writing checksum: %v", err)
+				}
+				innerBuf.Write(tmpBuf.Bytes())
+			}
+
+			resultBuf := bytes.NewBuffer(tt.outerResult)
+			resultBuf.WriteByte(byte(innerBuf.Len()))
+			resultBuf.Write(innerBuf.Bytes())
+			err = writeChecksum(resultBuf, checksums[ChecksumCRC32])
+			if err != nil {
+				t.Fatalf("error writing checksum: %v", err)
+			}
+
+			if !bytes.Equal(buf.Bytes(), resultBuf.Bytes()) {
+				t.Fatalf(`
+diff:
+%s
+				`, compareBytes(resultBuf.Bytes(), buf.Bytes()))
+			}
+		})
+	}
+}
+
+type embeddedBase struct {
+	ID   byte
+	Name string
+}
+
+type embeddedOther struct {
+	Name string
+}
+
+func TestEncodeUnexportedAndEmbeddedFields(t *testing.T) {
+	type withPrivate struct {
+		Public  byte
+		private string
+	}
+	type withEmbedded struct {
+		embeddedBase
+		*embeddedOther
+		Extra byte
+	}
+	type withNilEmbedded struct {
+		*embeddedBase
+		Extra byte
+	}
+
+	tests := []struct {
+		name         string
+		value        any
+		innerResults [][]byte
+	}{
+		{"private", withPrivate{Public: 0xDE, private: "secret"}, [][]byte{
+			{TypeUInt8, 'P', 'u', 'b', 'l', 'i', 'c', 0xFF, 0x01, 0x01, 0xDE},
+		}},
+		{"embedded", withEmbedded{embeddedBase{ID: 0x01, Name: "base"}, &embeddedOther{Name: "other"}, 0x02}, [][]byte{
+			{TypeUInt8, 'I', 'D', 0xFF, 0x01, 0x01, 0x01},
+			{TypeUInt8, 'E', 'x', 't', 'r', 'a', 0xFF, 0x01, 0x01, 0x02},
+		}},
+		{"nil embedded", withNilEmbedded{Extra: 0x02}, [][]byte{
+			{TypeUInt8, 'E', 'x', 't', 'r', 'a', 0xFF, 0x01, 0x01, 0x02},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			innerBuf := bytes.NewBuffer(nil)
+			for _, innerResult := range tt.innerResults {
+				tmpBuf := bytes.NewBuffer(innerResult)
+				err := writeChecksum(tmpBuf, checksums[ChecksumCRC32])
+				if err != nil {
+					t.Fatalf("error writing checksum: %v", err)
+				}
+				innerBuf.Write(tmpBuf.Bytes())
+			}
+
+			expected := bytes.NewBuffer([]byte{TypeStruct, 0xFF, 0x01, byte(innerBuf.Len())})
+			expected.Write(innerBuf.Bytes())
+			err := writeChecksum(expected, checksums[ChecksumCRC32])
+			if err != nil {
+				t.Fatalf("error writing checksum: %v", err)
+			}
+
+			buf := bytes.NewBuffer(nil)
+			err = encodeArgument(buf, tt.value, "")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !bytes.Equal(buf.Bytes(), expected.Bytes()) {
+				t.Fatalf(`
+diff
+%s
+				`, compareBytes(expected.Bytes(), buf.Bytes()))
+			}
+		})
+	}
+
+	t.Run("error on unexported", func(t *testing.T) {
+		buf := bytes.NewBuffer(nil)
+		err := encodeArgumentWithOptions(buf, withPrivate{}, "", Options(ErrorOnUnexportedFields(true)))
+		var unexportedErr *UnexportedFieldError
+		if !errors.As(err, &unexportedErr) {
+			t.Fatalf("expected UnexportedFieldError, got: %v", err)
+		}
+		if unexportedErr.Field != "private" {
+			t.Fatalf("expected field %q, got %q", "private", unexportedErr.Field)
+		}
+	})
+	t.Run("error on embedded unexported", func(t *testing.T) {
+		type inner struct {
+			X      int
+			secret string
+		}
+		type Inner2 struct {
+			Y      int
+			hidden string
+		}
+		type outer struct {
+			inner
+			*Inner2
+			Z int
+		}
+
+		buf := bytes.NewBuffer(nil)
+		err := encodeArgumentWithOptions(buf, outer{Inner2: &Inner2{}}, "", Options(ErrorOnUnexportedFields(true)))
+		var unexportedErr *UnexportedFieldError
+		if !errors.As(err, &unexportedErr) {
+			t.Fatalf("expected UnexportedFieldError, got: %v", err)
+		}
+		if unexportedErr.Field != "inner.secret" {
+			t.Fatalf("expected field %q, got %q", "inner.secret", unexportedErr.Field)
+		}
+
+		fields := cachedStructFields(reflect.TypeOf(outer{}))
+		if !reflect.DeepEqual(fields.unexported, []string{"inner.secret", "Inner2.hidden"}) {
+			t.Fatalf("expected unexported fields of every level, got %v", fields.unexported)
+		}
+	})
+}
+
+func TestEncodeTimeAndDuration(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  any
+		result []byte
+	}{
+		{"utc", time.Unix(0x12345678, 0x1ABCDEF).UTC(), []byte{
+			TypeTime, 'u', 't', 'c', 0xFF, 0x01, 0x0C,
+			0x00, 0x00, 0x00, 0x00, 0x12, 0x34, 0x56, 0x78,
+			0x01, 0xAB, 0xCD, 0xEF,
+		}},
+		{"zone", time.Unix(0x12345678, 0).In(time.FixedZone("CET", 3600)), []byte{
+			TypeTime, 'z', 'o', 'n', 'e', 0xFF, 0x01, 0x13,
+			0x00, 0x00, 0x00, 0x00, 0x12, 0x34, 0x56, 0x78,
+			0x00, 0x00, 0x00, 0x00,
+			0x00, 0x00, 0x0E, 0x10,
+			'C', 'E', 'T',
+		}},
+		{"duration", 1500 * time.Millisecond, []byte{
+			TypeDuration, 'd', 'u', 'r', 'a', 't', 'i', 'o', 'n', 0xFF, 0x01, 0x08,
+			0x00, 0x00, 0x00, 0x00, 0x59, 0x68, 0x2F, 0x00,
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := bytes.NewBuffer(nil)
+			err := encodeArgument(buf, tt.value, tt.name)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			resultBuf := bytes.NewBuffer(tt.result)
+			err = writeChecksum(resultBuf, checksums[ChecksumCRC32])
+			if err != nil {
+				t.Fatalf("error writing checksum: %v", err)
+			}
+
+			if !bytes.Equal(buf.Bytes(), resultBuf.Bytes()) {
+				t.Fatalf(`
+expected: %s
+got:      %s
+				`, bytesToHexString(resultBuf.Bytes()), bytesToHexString(buf.Bytes()))
+			}
+		})
+	}
+}
+
+func TestEncodeBytes(t *testing.T) {
+	type myByte byte
+
+	tests := []struct {
+		name   string
+		value  any
+		result []byte
+	}{
+		{"slice", []byte{0xDE, 0x68, 0xAA}, []byte{
+			TypeBytes, 's', 'l', 'i', 'c', 'e', 0xFF, 0x01, 0x03, 0xDE, 0x68, 0xAA,
+		}},
+		{"array", [4]byte{0xDE, 0xAD, 0xBE, 0xEF}, []byte{
+			TypeBytes, 'a', 'r', 'r', 'a', 'y', 0xFF, 0x01, 0x04, 0xDE, 0xAD, 0xBE, 0xEF,
+		}},
+		{"named", []myByte{0x01, 0x02}, []byte{
+			TypeBytes, 'n', 'a', 'm', 'e', 'd', 0xFF, 0x01, 0x02, 0x01, 0x02,
+		}},
+		{"empty", []byte{}, []byte{
+			TypeBytes, 'e', 'm', 'p', 't', 'y', 0xFF, 0x01, 0x00,
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := bytes.NewBuffer(nil)
+			err := encodeArgument(buf, tt.value, tt.name)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			resultBuf := bytes.NewBuffer(tt.result)
+			err = writeChecksum(resultBuf, checksums[ChecksumCRC32])
+			if err != nil {
+				t.Fatalf("error writing checksum: %v", err)
+			}
+
+			if !bytes.Equal(buf.Bytes(), resultBuf.Bytes()) {
+				t.Fatalf(`
+expected: %s
+got:      %s
+				`, bytesToHexString(resultBuf.Bytes()), bytesToHexString(buf.Bytes()))
+			}
+		})
+	}
+}
+
+func TestEncodePackedSlice(t *testing.T) {
+	type celsius float32
+
+	tests := []struct {
+		name   string
+		value  any
+		result []byte
+	}{
+		{"int16", []int16{1, -1, 0x1234}, []byte{
+			TypePackedSlice, 'i', 'n', 't', '1', '6', 0xFF, 0x01, 0x07,
+			TypeInt16, 0x00, 0x01, 0xFF, 0xFF, 0x12, 0x34,
+		}},
+		{"bools", []bool{true, false, true, true, false, false, false, false, true, true}, []byte{
+			TypePackedSlice, 'b', 'o', 'o', 'l', 's', 0xFF, 0x01, 0x04,
+			TypeBool, 0x06, 0xB0, 0xC0,
+		}},
+		{"array", [2]celsius{1.5, -2}, []byte{
+			TypePackedSlice, 'a', 'r', 'r', 'a', 'y', 0xFF, 0x01, 0x09,
+			TypeFloat32, 0x3F, 0xC0, 0x00, 0x00, 0xC0, 0x00, 0x00, 0x00,
+		}},
+		{"empty", []uint64{}, []byte{
+			TypePackedSlice, 'e', 'm', 'p', 't', 'y', 0xFF, 0x01, 0x01,
+			TypeUInt64,
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := bytes.NewBuffer(nil)
+			err := encodeArgument(buf, tt.value, tt.name)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			resultBuf := bytes.NewBuffer(tt.result)
+			err = writeChecksum(resultBuf, checksums[ChecksumCRC32])
+			if err != nil {
+				t.Fatalf("error writing checksum: %v", err)
+			}
+
+			if !bytes.Equal(buf.Bytes(), resultBuf.Bytes()) {
+				t.Fatalf(`
+expected: %s
+got:      %s
+				`, bytesToHexString(resultBuf.Bytes()), bytesToHexString(buf.Bytes()))
+			}
+		})
+	}
+}
+
+func TestEncodingErrorPath(t *testing.T) {
+	type user struct{ Values []any }
+
+	_, err := EncodeFunctionCall("call", Options(), map[string]any{
+		"a":    1,
+		"user": user{Values: []any{1, make(chan int)}},
+	})
+	var encodingErr *EncodingError
+	if !errors.As(err, &encodingErr) {
+		t.Fatalf("expected EncodingError, got %v", err)
+	}
+	if encodingErr.Path != "user.Values[1]" {
+		t.Fatalf("expected path %q, got %q", "user.Values[1]", encodingErr.Path)
+	}
+	var unsupported *UnsupportedTypeError
+	if !errors.As(err, &unsupported) {
+		t.Fatalf("expected UnsupportedTypeError, got %v", err)
+	}
+
+	valid, err := EncodeFunctionCall("call", Options(), map[string]any{"a": 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if encodingErr.Offset != len(valid)-4 {
+		t.Fatalf("expected offset %d, got %d", len(valid)-4, encodingErr.Offset)
+	}
+}
+
+type cycNode struct{ Next *cycNode }
+
+type recursivePointer *recursivePointer
+
+func TestEncodeCycle(t *testing.T) {
+	node := &cycNode{}
+	node.Next = node
+
+	var pointer recursivePointer
+	pointer = &pointer
+
+	t.Run("struct", func(t *testing.T) {
+		err := encodeArgument(bytes.NewBuffer(nil), node, "n")
+		var encodingErr *EncodingError
+		if !errors.As(err, &encodingErr) {
+			t.Fatalf("expected EncodingError, got %v", err)
+		}
+		var limitErr *LimitExceededError
+		if !errors.As(err, &limitErr) || limitErr.Limit != "depth" {
+			t.Fatalf("expected depth LimitExceededError, got %v", err)
+		}
+	})
+
+	t.Run("max depth", func(t *testing.T) {
+		err := encodeArgumentWithOptions(bytes.NewBuffer(nil), node, "n", Options(MaxDepth(3)))
+		var limitErr *LimitExceededError
+		if !errors.As(err, &limitErr) || limitErr.Path != "n.Next.Next.Next" {
+			t.Fatalf("expected depth limit at %q, got %v", "n.Next.Next.Next", err)
+		}
+	})
+
+	t.Run("pointer", func(t *testing.T) {
+		err := encodeArgument(bytes.NewBuffer(nil), pointer, "p")
+		var unsupported *UnsupportedTypeError
+		if !errors.As(err, &unsupported) {
+			t.Fatalf("expected UnsupportedTypeError, got %v", err)
+		}
+	})
+}
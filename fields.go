@@ -0,0 +1,236 @@
+package protocol
+
+import (
+	"go/token"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type structField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+	tagged    bool
+}
+
+type structFields struct {
+	list       []structField
+	byName     map[string]int
+	unexported []string
+}
+
+var structFieldCache sync.Map
+
+func cachedStructFields(t reflect.Type) *structFields {
+	if cached, ok := structFieldCache.Load(t); ok {
+		return cached.(*structFields)
+	}
+
+	fields := typeFields(t)
+	cached, _ := structFieldCache.LoadOrStore(t, fields)
+	return cached.(*structFields)
+}
+
+type embeddedStruct struct {
+	typ   reflect.Type
+	index []int
+	path  string
+}
+
+func typeFields(t reflect.Type) *structFields {
+	fields := &structFields{
+		byName: make(map[string]int),
+	}
+
+	var candidates []structField
+	visited := make(map[reflect.Type]bool)
+	next := []embeddedStruct{{typ: t}}
+	for len(next) > 0 {
+		current := next
+		next = nil
+		for _, embedded := range current {
+			if visited[embedded.typ] {
+				continue
+			}
+			visited[embedded.typ] = true
+
+			for i := 0; i < embedded.typ.NumField(); i++ {
+				field := embedded.typ.Field(i)
+				index := make([]int, len(embedded.index)+1)
+				copy(index, embedded.index)
+				index[len(embedded.index)] = i
+
+				name, tagged, omitEmpty, skip := parseStructTag(field)
+				if skip {
+					continue
+				}
+
+				if field.Anonymous {
+					fieldType := field.Type
+					if fieldType.Kind() == reflect.Ptr {
+						fieldType = fieldType.Elem()
+					}
+					if fieldType.Kind() == reflect.Struct && !tagged {
+						next = append(next, embeddedStruct{typ: fieldType, index: index, path: childPath(embedded.path, field.Name)})
+						continue
+					}
+				}
+
+				if !field.IsExported() {
+					fields.unexported = append(fields.unexported, childPath(embedded.path, field.Name))
+					continue
+				}
+
+				candidates = append(candidates, structField{
+					name:      name,
+					index:     index,
+					omitEmpty: omitEmpty,
+					tagged:    tagged,
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].name != candidates[j].name {
+			return candidates[i].name < candidates[j].name
+		}
+		if len(candidates[i].index) != len(candidates[j].index) {
+			return len(candidates[i].index) < len(candidates[j].index)
+		}
+		return candidates[i].tagged && !candidates[j].tagged
+	})
+
+	for i := 0; i < len(candidates); {
+		j := i + 1
+		for j < len(candidates) && candidates[j].name == candidates[i].name {
+			j++
+		}
+		if dominant, ok := dominantField(candidates[i:j]); ok {
+			fields.list = append(fields.list, dominant)
+		}
+		i = j
+	}
+
+	sort.Slice(fields.list, func(i, j int) bool {
+		return lessIndex(fields.list[i].index, fields.list[j].index)
+	})
+	for i, field := range fields.list {
+		fields.byName[field.name] = i
+	}
+
+	return fields
+}
+
+func dominantField(fields []structField) (structField, bool) {
+	if len(fields) > 1 && len(fields[0].index) == len(fields[1].index) && fields[0].tagged == fields[1].tagged {
+		return structField{}, false
+	}
+	return fields[0], true
+}
+
+func lessIndex(a, b []int) bool {
+	for i := range a {
+		if i >= len(b) {
+			return false
+		}
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
+
+func (f *structFields) byWireName(name string) (structField, bool) {
+	i, ok := f.byName[name]
+	if !ok {
+		return structField{}, false
+	}
+	return f.list[i], true
+}
+
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+func fieldByIndexAlloc(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, v.CanSet()
+}
+
+func parseStructTag(field reflect.StructField) (name string, tagged bool, omitEmpty bool, skip bool) {
+	tag, ok := field.Tag.Lookup("protocol")
+	if !ok {
+		return field.Name, false, false, false
+	}
+	if tag == "-" {
+		return "", false, false, true
+	}
+
+	name, flags, _ := strings.Cut(tag, ",")
+	tagged = name != ""
+	if !tagged {
+		name = field.Name
+	}
+	for _, flag := range strings.Split(flags, ",") {
+		if flag == "omitempty" {
+			omitEmpty = true
+		}
+	}
+	return name, tagged, omitEmpty, false
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128,
+		reflect.Interface, reflect.Pointer:
+		return v.IsZero()
+	}
+	return false
+}
+
+func structOfField(name string, typ reflect.Type) reflect.StructField {
+	if token.IsIdentifier(name) && token.IsExported(name) {
+		return reflect.StructField{Name: name, Type: typ}
+	}
+
+	goName := []rune{'X'}
+	for _, r := range name {
+		if r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			goName = append(goName, r)
+		}
+	}
+	return reflect.StructField{
+		Name: string(goName),
+		Type: typ,
+		Tag:  reflect.StructTag(`protocol:` + strconv.Quote(name)),
+	}
+}
@@ -0,0 +1,126 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+type fuzzTarget struct {
+	Int     int
+	Str     string
+	Struct  struct{ Something bool }
+	Slice   []int32
+	Map     map[string]int
+	AnyMap  map[any]any
+	Pointer *float64
+	Any     any
+	Time    time.Time
+	IP      net.IP
+}
+
+func fuzzSeeds() [][]byte {
+	args := []map[string]any{
+		{"int": 0xDE},
+		{"int": 0xDE, "bool": true, "str": "moin"},
+		{"string": "moin", "struct": struct{ Something bool }{true}},
+		{"slice": []any{1, "two", 3.0}, "nested": [][]any{{1}, {"a", nil}}},
+		{"map": map[string]any{"a": 1, "b": "c"}, "anyMap": map[any]any{1: "a", "b": 2.5}},
+		{"typedMap": map[int][]string{1: {"a"}, 2: nil}},
+		{"bytes": []byte("moin dikka"), "packed": []int32{1, -2, 3}, "bools": []bool{true, false, true}},
+		{"time": time.Date(2024, 5, 1, 12, 0, 0, 42, time.FixedZone("CEST", 7200)), "duration": time.Second},
+		{"nil": nil, "pointer": new(int), "ip": net.IPv4(127, 0, 0, 1)},
+	}
+
+	var seeds [][]byte
+	for _, test := range encodeFunctionCallTests {
+		data, err := EncodeFunctionCall(test.name, test.options, test.args)
+		if err != nil {
+			panic(err)
+		}
+		seeds = append(seeds, data)
+	}
+	for _, arg := range args {
+		for _, options := range []*options{Options(), Options(Compression(true)), Options(RequestID(42))} {
+			data, err := EncodeFunctionCall("fuzz", options, arg)
+			if err != nil {
+				panic(err)
+			}
+			seeds = append(seeds, data)
+		}
+	}
+	result, _ := EncodeFunctionResult("fuzz", Options(), map[string]any{"0": 1})
+	failure, _ := EncodeFunctionError("fuzz", Options(), &RemoteError{Code: 1, Message: "broken", Details: map[string]any{"a": 1}})
+	return append(seeds, result, failure)
+}
+
+func withFixedChecksum(data []byte) []byte {
+	if len(data) < 4 {
+		return data
+	}
+	buf := bytes.NewBuffer(bytes.Clone(data[:len(data)-4]))
+	_ = writeChecksum(buf, checksums[ChecksumCRC32])
+	return buf.Bytes()
+}
+
+func checkFuzzError(t *testing.T, err error) {
+	var decodingErr *DecodingError
+	var subversionErr *NonMatchingSubversionError
+	var kindErr *UnexpectedMessageKindError
+	var authenticationErr *AuthenticationError
+	if err != nil && !errors.As(err, &decodingErr) && !errors.As(err, &subversionErr) && !errors.As(err, &kindErr) && !errors.As(err, &authenticationErr) {
+		t.Fatalf("expected a DecodingError, got %T: %v", err, err)
+	}
+}
+
+func FuzzDecodeFunctionCall(f *testing.F) {
+	for _, seed := range fuzzSeeds() {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, data := range [][]byte{data, withFixedChecksum(data)} {
+			_, _, err := DecodeFunctionCall(data, Options())
+			checkFuzzError(t, err)
+
+			_, err = DecodeMessage(data, Options())
+			checkFuzzError(t, err)
+
+			var target fuzzTarget
+			_, err = DecodeFunctionCallInto(data, Options(), &target)
+			checkFuzzError(t, err)
+		}
+	})
+}
+
+func FuzzDecodeArgument(f *testing.F) {
+	for _, seed := range fuzzSeeds() {
+		message, err := readMessage(seed, Options())
+		if err != nil {
+			panic(err)
+		}
+		for _, argument := range message.arguments {
+			f.Add(argument)
+		}
+	}
+	for _, test := range decodeFixedArgumentTests {
+		f.Add(withFixedChecksum(append(bytes.Clone(test.data), 0, 0, 0, 0)))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, data := range [][]byte{data, withFixedChecksum(data)} {
+			_, _, _, err := decodeArgument(data)
+			if err != nil {
+				continue
+			}
+
+			argument := Argument{raw: data}
+			targets := []any{new(fuzzTarget), new(any), new([]string), new(map[float32]any), new(map[any][]byte), new([4]int8)}
+			for _, target := range targets {
+				checkFuzzError(t, argument.DecodeInto(target))
+			}
+		}
+	})
+}
@@ -0,0 +1,94 @@
+package protocol
+
+import "errors"
+
+const (
+	DefaultMaxDepth            = 64
+	DefaultMaxElements         = 1 << 20
+	DefaultMaxArguments        = 1024
+	DefaultMaxIdentifierLength = 1024
+)
+
+type decodeState struct {
+	options  *options
+	path     string
+	depth    int
+	offset   int
+	checksum *checksum
+
+	nestedChecksum *checksum
+}
+
+func newDecodeState(options *options) decodeState {
+	return decodeState{options: options, checksum: checksums[ChecksumCRC32], nestedChecksum: checksums[ChecksumCRC32]}
+}
+
+func newMessageState(message *rawMessage, options *options) decodeState {
+	state := newDecodeState(options)
+	state.checksum, state.nestedChecksum = message.checksum, message.nestedChecksum
+	return state
+}
+
+func (s decodeState) child(path string) (decodeState, error) {
+	child := s
+	child.path = path
+	child.depth++
+	if child.depth > s.options.maxDepthOrDefault() {
+		return s, child.wrap(&LimitExceededError{Limit: "depth", Path: path, Value: child.depth, Max: s.options.maxDepthOrDefault()})
+	}
+	return child, nil
+}
+
+func (s decodeState) field(name string) (decodeState, error) {
+	return s.child(childPath(s.path, name))
+}
+
+func (s decodeState) at(offset int) decodeState {
+	s.offset = offset
+	return s
+}
+
+func (s decodeState) content(data []byte, content []byte) decodeState {
+	return s.at(s.offset + len(data) - s.checksum.size - len(content))
+}
+
+func (s decodeState) nested() decodeState {
+	s.checksum = s.nestedChecksum
+	return s
+}
+
+func (s decodeState) wrap(err error) error {
+	var decodingErr *DecodingError
+	if err == nil || errors.As(err, &decodingErr) {
+		return err
+	}
+	return &DecodingError{Path: s.path, Offset: s.offset, err: err}
+}
+
+func (o *options) maxDepthOrDefault() int {
+	if o.maxDepth <= 0 {
+		return DefaultMaxDepth
+	}
+	return o.maxDepth
+}
+
+func (o *options) maxElementsOrDefault() int {
+	if o.maxElements <= 0 {
+		return DefaultMaxElements
+	}
+	return o.maxElements
+}
+
+func (o *options) maxArgumentsOrDefault() int {
+	if o.maxArguments <= 0 {
+		return DefaultMaxArguments
+	}
+	return o.maxArguments
+}
+
+func (o *options) maxIdentifierLengthOrDefault() int {
+	if o.maxIdentifierLength <= 0 {
+		return DefaultMaxIdentifierLength
+	}
+	return o.maxIdentifierLength
+}
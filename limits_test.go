@@ -0,0 +1,107 @@
+package protocol
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDecodeLimits(t *testing.T) {
+	type inner struct{ B []int }
+	type outer struct{ A []inner }
+
+	tests := []struct {
+		name    string
+		args    map[string]any
+		options []Option
+		limit   string
+		path    string
+	}{
+		{"depth", map[string]any{"a": outer{A: []inner{{B: []int{1}}}}}, []Option{MaxDepth(3)}, "depth", "a.A[0].B"},
+		{"slice elements", map[string]any{"a": []int{1, 2, 3}}, []Option{MaxElements(2)}, "elements", "a"},
+		{"packed elements", map[string]any{"a": []int32{1, 2, 3}}, []Option{MaxElements(2)}, "elements", "a"},
+		{"packed bool elements", map[string]any{"a": []bool{true, false, true}}, []Option{MaxElements(2)}, "elements", "a"},
+		{"map elements", map[string]any{"a": map[int]int{1: 1, 2: 2, 3: 3}}, []Option{MaxElements(2)}, "elements", "a"},
+		{"nested elements", map[string]any{"a": outer{A: []inner{{B: []int{1, 2, 3}}}}}, []Option{MaxElements(2)}, "elements", "a.A[0].B"},
+		{"arguments", map[string]any{"a": 1, "b": 2, "c": 3}, []Option{MaxArguments(2)}, "arguments", ""},
+		{"argument name", map[string]any{"abcdef": 1}, []Option{MaxIdentifierLength(4)}, "identifier length", ""},
+		{"field name", map[string]any{"a": struct{ Abcdef int }{1}}, []Option{MaxIdentifierLength(4)}, "identifier length", "a"},
+		{"decompressed size", map[string]any{"a": strings.Repeat("a", 4096)}, []Option{Compression(true), MaxMessageSize(1024)}, "decompressed size", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := Options(tt.options...)
+			data, err := EncodeFunctionCall("call", Options(CompressionCodec(options.codecOrDefault())), tt.args)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			_, _, err = DecodeFunctionCall(data, Options(CompressionCodec(options.codecOrDefault())))
+			if err != nil {
+				t.Fatalf("unexpected error with default limits: %v", err)
+			}
+
+			_, _, err = DecodeFunctionCall(data, options)
+			var limitErr *LimitExceededError
+			if !errors.As(err, &limitErr) {
+				t.Fatalf("expected limit exceeded error, got %v", err)
+			}
+			if limitErr.Limit != tt.limit {
+				t.Fatalf("expected %s limit, got %s", tt.limit, limitErr.Limit)
+			}
+			if limitErr.Path != tt.path {
+				t.Fatalf("expected path %q, got %q", tt.path, limitErr.Path)
+			}
+		})
+	}
+}
+
+func TestDecodeIntoLimits(t *testing.T) {
+	type inner struct{ B []int }
+	type outer struct{ A []inner }
+
+	data, err := EncodeFunctionCall("call", Options(), map[string]any{"a": outer{A: []inner{{B: []int{1, 2, 3}}}}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		options []Option
+		limit   string
+		path    string
+	}{
+		{"depth", []Option{MaxDepth(3)}, "depth", "a.A[0].B"},
+		{"elements", []Option{MaxElements(2)}, "elements", "a.A[0].B"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var target struct {
+				A outer `protocol:"a"`
+			}
+			_, err := DecodeFunctionCallInto(data, Options(tt.options...), &target)
+			var limitErr *LimitExceededError
+			if !errors.As(err, &limitErr) {
+				t.Fatalf("expected limit exceeded error, got %v", err)
+			}
+			if limitErr.Limit != tt.limit || limitErr.Path != tt.path {
+				t.Fatalf("expected %s limit at %q, got %v", tt.limit, tt.path, limitErr)
+			}
+		})
+	}
+}
+
+func TestDecodeMessageSizeLimit(t *testing.T) {
+	data, err := EncodeFunctionCall("call", Options(), map[string]any{"a": strings.Repeat("a", 128)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, _, err = DecodeFunctionCall(data, Options(MaxMessageSize(64)))
+	var tooLarge *MessageTooLargeError
+	if !errors.As(err, &tooLarge) {
+		t.Fatalf("expected message too large error, got %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package protocol
+
+import (
+	"encoding"
+	"reflect"
+)
+
+type Marshaler interface {
+	MarshalProtocol() ([]byte, error)
+}
+
+// UnmarshalProtocol must copy the data if it wishes to retain it after returning.
+type Unmarshaler interface {
+	UnmarshalProtocol(data []byte) error
+}
+
+var (
+	marshalerType       = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	binaryMarshalerType = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+func marshalerTypeTag(t reflect.Type) (byte, bool) {
+	if _, ok := builtinTypeTags[t]; ok {
+		return 0x00, false
+	}
+
+	types := []reflect.Type{t}
+	if t.Kind() != reflect.Ptr {
+		types = append(types, reflect.PointerTo(t))
+	}
+
+	for _, candidate := range types {
+		switch {
+		case candidate.Implements(marshalerType), candidate.Implements(binaryMarshalerType):
+			return TypeBytes, true
+		case candidate.Implements(textMarshalerType):
+			return TypeString, true
+		}
+	}
+	return 0x00, false
+}
+
+func marshalValue(value any) ([]byte, bool, error) {
+	reflectValue := reflect.ValueOf(value)
+	for reflectValue.Kind() == reflect.Ptr && !reflectValue.IsNil() {
+		reflectValue = reflectValue.Elem()
+	}
+	if !reflectValue.IsValid() || reflectValue.Kind() == reflect.Ptr {
+		return nil, false, nil
+	}
+	if _, ok := marshalerTypeTag(reflectValue.Type()); !ok {
+		return nil, false, nil
+	}
+
+	if reflectValue.CanAddr() {
+		reflectValue = reflectValue.Addr()
+	} else {
+		pointer := reflect.New(reflectValue.Type())
+		pointer.Elem().Set(reflectValue)
+		reflectValue = pointer
+	}
+
+	switch marshaler := reflectValue.Interface().(type) {
+	case Marshaler:
+		data, err := marshaler.MarshalProtocol()
+		return data, true, err
+	case encoding.BinaryMarshaler:
+		data, err := marshaler.MarshalBinary()
+		return data, true, err
+	case encoding.TextMarshaler:
+		data, err := marshaler.MarshalText()
+		return data, true, err
+	}
+	return nil, false, nil
+}
+
+func unmarshalValue(typ byte, content []byte, target reflect.Value) (bool, error) {
+	if !target.CanAddr() {
+		return false, nil
+	}
+
+	pointer := target.Addr().Interface()
+	if unmarshaler, ok := pointer.(Unmarshaler); ok && typ == TypeBytes {
+		return true, unmarshaler.UnmarshalProtocol(content)
+	}
+	if unmarshaler, ok := pointer.(encoding.BinaryUnmarshaler); ok && typ == TypeBytes {
+		return true, unmarshaler.UnmarshalBinary(content)
+	}
+	if unmarshaler, ok := pointer.(encoding.TextUnmarshaler); ok && typ == TypeString {
+		return true, unmarshaler.UnmarshalText(content)
+	}
+	return false, nil
+}
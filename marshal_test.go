@@ -0,0 +1,119 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+type point struct {
+	X, Y int8
+}
+
+func (p point) MarshalProtocol() ([]byte, error) {
+	return []byte{byte(p.X), byte(p.Y)}, nil
+}
+
+func (p *point) UnmarshalProtocol(data []byte) error {
+	if len(data) != 2 {
+		return fmt.Errorf("expected 2 bytes, got %d", len(data))
+	}
+	p.X, p.Y = int8(data[0]), int8(data[1])
+	return nil
+}
+
+type failingMarshaler struct{}
+
+func (failingMarshaler) MarshalProtocol() ([]byte, error) {
+	return nil, errors.New("nope")
+}
+
+func TestEncodeMarshaler(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  any
+		result []byte
+	}{
+		{"point", point{X: 1, Y: -1}, []byte{
+			TypeBytes, 'p', 'o', 'i', 'n', 't', 0xFF, 0x01, 0x02, 0x01, 0xFF,
+		}},
+		{"pointer", &point{X: 1, Y: 2}, []byte{
+			TypeBytes, 'p', 'o', 'i', 'n', 't', 'e', 'r', 0xFF, 0x01, 0x02, 0x01, 0x02,
+		}},
+		{"text", net.IPv4(127, 0, 0, 1), []byte{
+			TypeString, 't', 'e', 'x', 't', 0xFF, 0x01, 0x09, '1', '2', '7', '.', '0', '.', '0', '.', '1',
+		}},
+		{"binary", url.URL{Scheme: "https", Host: "moin"}, []byte{
+			TypeBytes, 'b', 'i', 'n', 'a', 'r', 'y', 0xFF, 0x01, 0x0C, 'h', 't', 't', 'p', 's', ':', '/', '/', 'm', 'o', 'i', 'n',
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := bytes.NewBuffer(nil)
+			err := encodeArgument(buf, tt.value, tt.name)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			resultBuf := bytes.NewBuffer(tt.result)
+			err = writeChecksum(resultBuf, checksums[ChecksumCRC32])
+			if err != nil {
+				t.Fatalf("error writing checksum: %v", err)
+			}
+
+			if !bytes.Equal(buf.Bytes(), resultBuf.Bytes()) {
+				t.Fatalf(`
+expected: %s
+got:      %s
+				`, bytesToHexString(resultBuf.Bytes()), bytesToHexString(buf.Bytes()))
+			}
+		})
+	}
+
+	t.Run("error", func(t *testing.T) {
+		err := encodeArgument(bytes.NewBuffer(nil), failingMarshaler{}, "error")
+		var encodingErr *EncodingError
+		if !errors.As(err, &encodingErr) {
+			t.Fatalf("expected EncodingError, got: %v", err)
+		}
+	})
+}
+
+func TestDecodeIntoUnmarshaler(t *testing.T) {
+	type request struct {
+		Origin   point
+		Path     []point
+		Optional *point
+		Address  net.IP
+		Endpoint url.URL
+	}
+
+	sent := request{
+		Origin:   point{X: 1, Y: 2},
+		Path:     []point{{X: -1, Y: -2}, {X: 3, Y: 4}},
+		Optional: &point{X: 5, Y: 6},
+		Address:  net.ParseIP("2001:db8::1"),
+		Endpoint: url.URL{Scheme: "https", Host: "moin", Path: "/dikka"},
+	}
+
+	options := Options()
+	data, err := EncodeFunctionCall("marshal", options, map[string]any{"request": sent})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var received request
+	_, err = DecodeFunctionCallInto(data, options, map[string]any{"request": &received})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(received, sent) {
+		t.Fatalf("expected: %#v, got: %#v", sent, received)
+	}
+}
@@ -1,9 +1,33 @@
 package protocol
 
+import "crypto/ed25519"
+
 type options struct {
 	version     uint8
 	subversion  uint8
 	compression bool
+	codec       byte
+
+	autoCompression      bool
+	compressionThreshold int
+	compressionLevel     int
+	compressionLevelSet  bool
+
+	errorOnUnexportedFields bool
+
+	maxMessageSize      int
+	maxDepth            int
+	maxElements         int
+	maxArguments        int
+	maxIdentifierLength int
+
+	checksumAlgorithm byte
+	argumentChecksums byte
+
+	signingKey       *signingKey
+	verificationKeys KeyProvider
+
+	requestID uint64
 }
 
 type Option func(*options)
@@ -26,6 +50,115 @@ func Compression(compression bool) Option {
 	}
 }
 
+func CompressionCodec(codec byte) Option {
+	return func(o *options) {
+		o.compression = codec != CodecNone
+		o.codec = codec
+	}
+}
+
+func AutoCompression(threshold int) Option {
+	return func(o *options) {
+		o.compression = true
+		o.autoCompression = true
+		o.compressionThreshold = threshold
+	}
+}
+
+func CompressionLevel(level int) Option {
+	return func(o *options) {
+		o.compressionLevel = level
+		o.compressionLevelSet = true
+	}
+}
+
+func ChecksumAlgorithm(algorithm byte) Option {
+	return func(o *options) {
+		o.checksumAlgorithm = algorithm
+	}
+}
+
+func ArgumentChecksums(mode byte) Option {
+	return func(o *options) {
+		o.argumentChecksums = mode
+	}
+}
+
+func HMACSigningKey(keyID string, secret []byte) Option {
+	return func(o *options) {
+		o.signingKey = &signingKey{mode: AuthHMACSHA256, keyID: keyID, key: secret}
+	}
+}
+
+func Ed25519SigningKey(keyID string, key ed25519.PrivateKey) Option {
+	return func(o *options) {
+		o.signingKey = &signingKey{mode: AuthEd25519, keyID: keyID, key: key}
+	}
+}
+
+func VerificationKeys(provider KeyProvider) Option {
+	return func(o *options) {
+		o.verificationKeys = provider
+	}
+}
+
+func ErrorOnUnexportedFields(errorOnUnexportedFields bool) Option {
+	return func(o *options) {
+		o.errorOnUnexportedFields = errorOnUnexportedFields
+	}
+}
+
+func MaxMessageSize(maxMessageSize int) Option {
+	return func(o *options) {
+		o.maxMessageSize = maxMessageSize
+	}
+}
+
+func MaxDepth(maxDepth int) Option {
+	return func(o *options) {
+		o.maxDepth = maxDepth
+	}
+}
+
+func MaxElements(maxElements int) Option {
+	return func(o *options) {
+		o.maxElements = maxElements
+	}
+}
+
+func MaxArguments(maxArguments int) Option {
+	return func(o *options) {
+		o.maxArguments = maxArguments
+	}
+}
+
+func MaxIdentifierLength(maxIdentifierLength int) Option {
+	return func(o *options) {
+		o.maxIdentifierLength = maxIdentifierLength
+	}
+}
+
+func RequestID(requestID uint64) Option {
+	return func(o *options) {
+		o.requestID = requestID
+	}
+}
+
+func (o *options) with(opts ...Option) *options {
+	copied := *o
+	for _, opt := range opts {
+		opt(&copied)
+	}
+	return &copied
+}
+
+func (o *options) maxMessageSizeOrDefault() int {
+	if o.maxMessageSize <= 0 {
+		return DefaultMaxMessageSize
+	}
+	return o.maxMessageSize
+}
+
 func Options(opts ...Option) *options {
 	o := &options{
 		version:     1,
@@ -0,0 +1,110 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+)
+
+var packedElementTypes = map[byte]reflect.Type{
+	TypeBool:       reflect.TypeOf(false),
+	TypeUInt8:      reflect.TypeOf(uint8(0)),
+	TypeUInt16:     reflect.TypeOf(uint16(0)),
+	TypeUInt32:     reflect.TypeOf(uint32(0)),
+	TypeUInt64:     reflect.TypeOf(uint64(0)),
+	TypeInt8:       reflect.TypeOf(int8(0)),
+	TypeInt16:      reflect.TypeOf(int16(0)),
+	TypeInt32:      reflect.TypeOf(int32(0)),
+	TypeInt64:      reflect.TypeOf(int64(0)),
+	TypeFloat32:    reflect.TypeOf(float32(0)),
+	TypeFloat64:    reflect.TypeOf(float64(0)),
+	TypeComplex64:  reflect.TypeOf(complex64(0)),
+	TypeComplex128: reflect.TypeOf(complex128(0)),
+}
+
+func packedElementTypeTag(t reflect.Type) (byte, bool) {
+	if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+		return 0x00, false
+	}
+
+	element := t.Elem()
+	if _, ok := builtinTypeTags[element]; ok {
+		return 0x00, false
+	}
+	if _, ok := marshalerTypeTag(element); ok {
+		return 0x00, false
+	}
+	typeTag, ok := simpleTypeTagMappings[element.Kind()]
+	return typeTag, ok && isFixedType(typeTag)
+}
+
+func encodePackedSlice(value reflect.Value) ([]byte, error) {
+	elementTag, _ := packedElementTypeTag(value.Type())
+	content := bytes.NewBuffer(nil)
+	content.WriteByte(elementTag)
+
+	if elementTag == TypeBool {
+		bits := make([]byte, (value.Len()+7)/8)
+		for i := 0; i < value.Len(); i++ {
+			if value.Index(i).Bool() {
+				bits[i/8] |= 0x80 >> (i % 8)
+			}
+		}
+		content.WriteByte(byte(len(bits)*8 - value.Len()))
+		content.Write(bits)
+		return content.Bytes(), nil
+	}
+
+	err := binary.Write(content, binary.BigEndian, value.Interface())
+	if err != nil {
+		return nil, err
+	}
+	return content.Bytes(), nil
+}
+
+func decodePackedSlice(content []byte, state decodeState) (reflect.Value, error) {
+	if len(content) == 0 {
+		return reflect.Value{}, fmt.Errorf("packed slice without element type")
+	}
+
+	elementTag, data := content[0], content[1:]
+	elementType, ok := packedElementTypes[elementTag]
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("invalid packed slice element type: %v", elementTag)
+	}
+
+	if elementTag == TypeBool {
+		if len(data) == 0 {
+			return reflect.Value{}, fmt.Errorf("packed bool slice without padding")
+		}
+		unused, bits := int(data[0]), data[1:]
+		if unused > 7 || len(bits) == 0 && unused != 0 {
+			return reflect.Value{}, fmt.Errorf("invalid packed bool slice padding: %v", unused)
+		}
+		length := len(bits)*8 - unused
+		if length > state.options.maxElementsOrDefault() {
+			return reflect.Value{}, &LimitExceededError{Limit: "elements", Path: state.path, Value: length, Max: state.options.maxElementsOrDefault()}
+		}
+		slice := make([]bool, length)
+		for i := range slice {
+			slice[i] = bits[i/8]&(0x80>>(i%8)) != 0
+		}
+		return reflect.ValueOf(slice), nil
+	}
+
+	size := int(elementType.Size())
+	if len(data)%size != 0 {
+		return reflect.Value{}, fmt.Errorf("packed %s slice content of %d bytes", TypeToString[elementTag], len(data))
+	}
+	length := len(data) / size
+	if length > state.options.maxElementsOrDefault() {
+		return reflect.Value{}, &LimitExceededError{Limit: "elements", Path: state.path, Value: length, Max: state.options.maxElementsOrDefault()}
+	}
+	slice := reflect.MakeSlice(reflect.SliceOf(elementType), length, length)
+	err := binary.Read(bytes.NewReader(data), binary.BigEndian, slice.Interface())
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	return slice, nil
+}
@@ -2,14 +2,36 @@ package protocol
 
 import (
 	"bytes"
-	"compress/gzip"
 	"encoding/binary"
+	"errors"
 	"fmt"
-	"hash/crc32"
 	"io"
 	"sort"
 )
 
+const headerSize = 16
+
+const (
+	codecOffset    = 10
+	kindOffset     = 11
+	flagsOffset    = 12
+	checksumOffset = 13
+	authOffset     = 14
+)
+
+const (
+	flagRequestID byte = 1 << iota
+	flagArgumentChecksumsLow
+	flagArgumentChecksumsHigh
+)
+
+const (
+	flagArgumentChecksums      = flagArgumentChecksumsLow | flagArgumentChecksumsHigh
+	flagArgumentChecksumsShift = 1
+)
+
+const knownFlags = flagRequestID | flagArgumentChecksums
+
 func writeIdentifier(buf *bytes.Buffer, name string) error {
 	_, err := buf.Write([]byte(name))
 	if err != nil {
@@ -22,18 +44,23 @@ func writeIdentifier(buf *bytes.Buffer, name string) error {
 	return nil
 }
 
-func writeChecksum(buffer *bytes.Buffer) error {
-	checksum := crc32.ChecksumIEEE(buffer.Bytes())
-	checksumBuffer := make([]byte, 4)
-	binary.BigEndian.PutUint32(checksumBuffer, checksum)
-	buffer.Write(checksumBuffer)
-	return nil
+func EncodeFunctionCall(name string, options *options, args map[string]any) ([]byte, error) {
+	return encodeMessage(KindCall, name, options, args)
 }
 
-func EncodeFunctionCall(name string, options *options, args map[string]any) ([]byte, error) {
+func encodeMessage(kind MessageKind, name string, options *options, args map[string]any) ([]byte, error) {
+	algorithm, err := checksumByID(options.checksumAlgorithm)
+	if err != nil {
+		return nil, &EncodingError{Offset: checksumOffset, err: err}
+	}
+	_, _, err = argumentChecksums(algorithm, options.argumentChecksums)
+	if err != nil {
+		return nil, &EncodingError{Offset: flagsOffset, err: err}
+	}
+
 	buf := bytes.NewBuffer(nil)
 
-	_, err := buf.Write(signature)
+	_, err = buf.Write(signature)
 	if err != nil {
 		return nil, err
 	}
@@ -46,20 +73,40 @@ func EncodeFunctionCall(name string, options *options, args map[string]any) ([]b
 	if err != nil {
 		return nil, err
 	}
-	if options.compression {
-		err = buf.WriteByte(1)
-	} else {
-		err = buf.WriteByte(0)
-	}
+	err = buf.WriteByte(CodecNone)
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = buf.Write([]byte{0, 0, 0, 0, 0})
+	flags := options.argumentChecksums << flagArgumentChecksumsShift
+	if options.requestID != 0 {
+		flags |= flagRequestID
+	}
+
+	authMode := AuthNone
+	if options.signingKey != nil {
+		authMode = options.signingKey.mode
+	}
+
+	_, err = buf.Write([]byte{byte(kind), flags, options.checksumAlgorithm, authMode, 0})
 	if err != nil {
 		return nil, err
 	}
 
+	if flags&flagRequestID != 0 {
+		_, err = buf.Write(binary.BigEndian.AppendUint64(nil, options.requestID))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if authMode != AuthNone {
+		err = writeIdentifier(buf, options.signingKey.keyID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	err = writeIdentifier(buf, name)
 	if err != nil {
 		return nil, err
@@ -76,29 +123,40 @@ func EncodeFunctionCall(name string, options *options, args map[string]any) ([]b
 	argsBuffer := bytes.NewBuffer(nil)
 	for _, key := range argKeys {
 		arg := args[key]
-		err := encodeArgument(argsBuffer, arg, key)
+		err := encodeArgumentWithOptions(argsBuffer, arg, key, options)
+		var encodingErr *EncodingError
+		if errors.As(err, &encodingErr) {
+			encodingErr.Offset = buf.Len() + argsBuffer.Len()
+		}
 		if err != nil {
 			return nil, err
 		}
 
 	}
 
-	var content []byte
-	if options.compression {
-		content, err = compressBuffer(argsBuffer)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		content = argsBuffer.Bytes()
+	content, codecID, err := compressArguments(argsBuffer.Bytes(), options)
+	if err != nil {
+		return nil, &EncodingError{Offset: codecOffset, err: err}
 	}
+	buf.Bytes()[codecOffset] = codecID
 
 	_, err = buf.Write(content)
 	if err != nil {
 		return nil, err
 	}
 
-	err = writeChecksum(buf)
+	if authMode != AuthNone {
+		messageSignature, err := options.signingKey.sign(buf.Bytes())
+		if err != nil {
+			return nil, &EncodingError{Offset: buf.Len(), err: err}
+		}
+		_, err = buf.Write(messageSignature)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = writeChecksum(buf, algorithm)
 	if err != nil {
 		return nil, err
 	}
@@ -106,9 +164,9 @@ func EncodeFunctionCall(name string, options *options, args map[string]any) ([]b
 	return buf.Bytes(), nil
 }
 
-func compressBuffer(buffer *bytes.Buffer) ([]byte, error) {
+func compressBuffer(buffer *bytes.Buffer, codec Codec, level int) ([]byte, error) {
 	compressedBuffer := bytes.NewBuffer(nil)
-	writer, err := gzip.NewWriterLevel(compressedBuffer, gzip.BestCompression)
+	writer, err := codec.NewWriter(compressedBuffer, level)
 	if err != nil {
 		return nil, err
 	}
@@ -128,102 +186,224 @@ type Argument struct {
 	Name  string
 	Value any
 	Typ   byte
+
+	raw   []byte
+	state decodeState
+}
+
+type rawMessage struct {
+	kind       MessageKind
+	subversion byte
+	requestID  uint64
+	name       string
+	arguments  [][]byte
+
+	argumentsOffset int
+	checksum        *checksum
+	nestedChecksum  *checksum
 }
 
 func DecodeFunctionCall(data []byte, options *options) (string, map[string]Argument, error) {
+	message, err := readMessage(data, options)
+	if err != nil {
+		return "", nil, decodingError(err)
+	}
+	if message.kind != KindCall {
+		return "", nil, &UnexpectedMessageKindError{Expected: KindCall, Actual: message.kind}
+	}
+
+	args, err := decodeArguments(message, options)
+	if err != nil {
+		return "", nil, decodingError(err)
+	}
+
+	return message.name, args, checkSubversion(options, message.subversion)
+}
+
+func decodeArguments(message *rawMessage, options *options) (map[string]Argument, error) {
+	state := newMessageState(message, options)
+	args := make(map[string]Argument)
+	offset := message.argumentsOffset
+	for _, data := range message.arguments {
+		name, value, typ, err := decodeArgumentWithState(data, state.at(offset))
+		if err != nil {
+			return nil, err
+		}
+		args[name] = Argument{
+			Name:  name,
+			Value: value,
+			Typ:   typ,
+			raw:   data,
+			state: state.at(offset),
+		}
+		offset += len(data)
+	}
+	return args, nil
+}
+
+func readMessage(data []byte, options *options) (*rawMessage, error) {
+	if len(data) > options.maxMessageSizeOrDefault() {
+		return nil, &MessageTooLargeError{Size: len(data), Limit: options.maxMessageSizeOrDefault()}
+	}
+	state := newDecodeState(options)
 	buf := bytes.NewBuffer(data)
 
 	signature := buf.Next(8)
 	if !bytes.Equal(signature, Signature()) {
-		return "", nil, fmt.Errorf("invalid signature")
+		return nil, state.wrap(ErrInvalidSignature)
+	}
+	if len(data) < headerSize {
+		return nil, state.at(len(data)).wrap(fmt.Errorf("%w: message of %d bytes is too short", ErrTruncated, len(data)))
+	}
+
+	version, _ := buf.ReadByte()
+	subversion, _ := buf.ReadByte()
+	if version != options.version {
+		return nil, state.at(8).wrap(fmt.Errorf("%w %d, expected %d", ErrInvalidVersion, version, options.version))
+	}
+
+	codecID, _ := buf.ReadByte()
+	var codec Codec
+	if codecID != CodecNone {
+		var err error
+		codec, err = codecByID(codecID)
+		if err != nil {
+			return nil, state.at(codecOffset).wrap(err)
+		}
 	}
 
-	version, err := buf.ReadByte()
+	reserved := buf.Next(5)
+	kind := MessageKind(reserved[0])
+	if kind > KindError {
+		return nil, state.at(kindOffset).wrap(fmt.Errorf("unknown message kind %d", kind))
+	}
+	flags := reserved[1]
+	if flags&^knownFlags != 0 {
+		return nil, state.at(flagsOffset).wrap(fmt.Errorf("unknown header flags %08b", flags&^knownFlags))
+	}
+	algorithm, err := checksumByID(reserved[2])
 	if err != nil {
-		return "", nil, err
+		return nil, state.at(checksumOffset).wrap(err)
 	}
-	subversion, err := buf.ReadByte()
+	topLevel, nested, err := argumentChecksums(algorithm, (flags&flagArgumentChecksums)>>flagArgumentChecksumsShift)
 	if err != nil {
-		return "", nil, err
+		return nil, state.at(flagsOffset).wrap(err)
+	}
+	state.checksum, state.nestedChecksum = topLevel, nested
+	authMode := reserved[3]
+	signatureSize, ok := signatureSizes[authMode]
+	if !ok {
+		return nil, state.at(authOffset).wrap(fmt.Errorf("unknown authentication mode %d", authMode))
+	}
+	if len(data) < headerSize+algorithm.size {
+		return nil, state.at(len(data)).wrap(fmt.Errorf("%w: message of %d bytes is too short", ErrTruncated, len(data)))
 	}
 
-	if version != options.version {
-		return "", nil, fmt.Errorf("Invalid version")
+	var requestID uint64
+	if flags&flagRequestID != 0 {
+		requestIDBytes := buf.Next(8)
+		if len(requestIDBytes) < 8 {
+			return nil, state.at(headerSize).wrap(fmt.Errorf("%w: missing request id", ErrTruncated))
+		}
+		requestID = binary.BigEndian.Uint64(requestIDBytes)
 	}
 
-	invalidSubversion := false
-	if subversion != options.subversion {
-		invalidSubversion = true
+	var keyID string
+	if authMode != AuthNone {
+		keyID, err = readIdentifier(buf, state)
+		if err != nil {
+			return nil, state.at(len(data) - buf.Len()).wrap(err)
+		}
 	}
 
-	compression, err := buf.ReadByte()
+	name, err := readIdentifier(buf, state)
 	if err != nil {
-		return "", nil, err
+		return nil, state.at(len(data) - buf.Len()).wrap(err)
 	}
-	useCompression := compression == 1
-
-	buf.Next(5)
 
-	name, err := readIdentifier(buf)
-	if err != nil {
-		return "", nil, err
+	if buf.Len() < signatureSize+algorithm.size {
+		return nil, state.at(len(data)).wrap(fmt.Errorf("%w: message is too short for its checksum", ErrTruncated))
+	}
+	argumentsOffset := len(data) - buf.Len()
+	argData := buf.Next(buf.Len() - signatureSize - algorithm.size)
+	messageSignature := buf.Next(signatureSize)
+	checksum := buf.Next(algorithm.size)
+	checkedData := data[:len(data)-algorithm.size]
+	if !verifyChecksum(checkedData, checksum, algorithm) {
+		return nil, state.at(len(data) - algorithm.size).wrap(fmt.Errorf("message %w", ErrChecksumMismatch))
 	}
 
-	argData := buf.Next(buf.Len() - 4)
-	checksum := buf.Next(4)
-	checkedData := data[:len(data)-4]
-	if !verifyChecksum(checkedData, checksum) {
-		return "", nil, fmt.Errorf("FunctionCalls checksum verification failed")
+	err = authenticateMessage(checkedData[:len(checkedData)-signatureSize], messageSignature, authMode, keyID, options.verificationKeys)
+	if err != nil {
+		return nil, err
 	}
 
-	argBuffer := bytes.NewBuffer(nil)
-	if useCompression {
-		argBuffer, err = decompressBuffer(argData)
+	if codec != nil {
+		argBuffer, err := decompressBuffer(argData, codec, options.maxMessageSizeOrDefault())
 		if err != nil {
-			return "", nil, err
+			return nil, state.at(argumentsOffset).wrap(err)
 		}
-	} else {
-		argBuffer.Write(argData)
+		argData, argumentsOffset = argBuffer.Bytes(), 0
 	}
 
-	args := make(map[string]Argument)
-	splitData, err := splitArgumentListData(argBuffer.Bytes())
+	splitData, err := splitArgumentList(argData, state.at(argumentsOffset), "arguments", options.maxArgumentsOrDefault(), 1)
 	if err != nil {
-		return "", nil, err
+		return nil, err
 	}
-	for _, data := range splitData {
-		name, value, typ, err := decodeArgument(data)
-		if err != nil {
-			return "", nil, err
-		}
-		args[name] = Argument{
-			Name:  name,
-			Value: value,
-			Typ:   typ,
-		}
+
+	return &rawMessage{
+		kind:            kind,
+		subversion:      subversion,
+		requestID:       requestID,
+		name:            name,
+		arguments:       splitData,
+		argumentsOffset: argumentsOffset,
+		checksum:        topLevel,
+		nestedChecksum:  nested,
+	}, nil
+}
+
+// readRequestID reads the kind and the request ID from the header of data
+// without looking at the rest of the message, so that a message that fails
+// to decode can still be matched to the call it belongs to.
+func readRequestID(data []byte) (MessageKind, uint64, bool) {
+	if len(data) < headerSize || !bytes.Equal(data[:len(signature)], signature) {
+		return 0, 0, false
+	}
+	kind := MessageKind(data[kindOffset])
+	if data[flagsOffset]&flagRequestID == 0 {
+		return kind, 0, true
 	}
+	algorithm, err := checksumByID(data[checksumOffset])
+	if err != nil || len(data) < headerSize+8+algorithm.size {
+		return 0, 0, false
+	}
+	return kind, binary.BigEndian.Uint64(data[headerSize:]), true
+}
 
-	if invalidSubversion {
-		err = &NonMatchingSubversionError{
+func checkSubversion(options *options, subversion byte) error {
+	if subversion != options.subversion {
+		return &NonMatchingSubversionError{
 			Expected: options.subversion,
 			Actual:   subversion,
 		}
-	} else {
-		err = nil
 	}
-
-	return name, args, err
+	return nil
 }
 
-func decompressBuffer(buffer []byte) (*bytes.Buffer, error) {
-	reader, err := gzip.NewReader(bytes.NewReader(buffer))
+func decompressBuffer(buffer []byte, codec Codec, limit int) (*bytes.Buffer, error) {
+	reader, err := codec.NewReader(bytes.NewReader(buffer))
 	if err != nil {
 		return nil, err
 	}
+	defer reader.Close()
 	decompressedBuffer := bytes.NewBuffer(nil)
-	_, err = io.Copy(decompressedBuffer, reader)
+	n, err := io.Copy(decompressedBuffer, io.LimitReader(reader, int64(limit)+1))
 	if err != nil {
 		return nil, err
 	}
+	if n > int64(limit) {
+		return nil, &LimitExceededError{Limit: "decompressed size", Value: int(n), Max: limit}
+	}
 	return decompressedBuffer, nil
 }
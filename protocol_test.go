@@ -2,100 +2,102 @@ package protocol
 
 import (
 	"bytes"
+	"encoding/binary"
+	"errors"
 	"math/rand"
 	"reflect"
 	"sort"
 	"testing"
 )
 
-func TestEncodeFunctionCall(t *testing.T) {
-	tests := []struct {
-		name     string
-		options  *options
-		args     map[string]any
-		expected []byte
-	}{
-		{
-			name: "single primitive",
-			options: &options{
-				version:     1,
-				subversion:  0,
-				compression: false,
-			},
-			args: map[string]any{"int": 0xDE},
-			expected: []byte{
-				0x69, 0xDE, 0xDE, 0x69, 0xF0, 0x9F, 0x90, 0xBB,
-				1, 0,
-				0x00,
-				0x00, 0x00, 0x00, 0x00, 0x00,
-				's', 'i', 'n', 'g', 'l', 'e', ' ', 'p', 'r', 'i', 'm', 'i', 't', 'i', 'v', 'e', 0xFF,
-			},
+var encodeFunctionCallTests = []struct {
+	name     string
+	options  *options
+	args     map[string]any
+	expected []byte
+}{
+	{
+		name: "single primitive",
+		options: &options{
+			version:     1,
+			subversion:  0,
+			compression: false,
 		},
-		{
-			name: "multiple primitives",
-			options: &options{
-				version:     1,
-				subversion:  0,
-				compression: false,
-			},
-			args: map[string]any{
-				"int":  0xDE,
-				"bool": true,
-				"str":  "moin",
-			},
-			expected: []byte{
-				0x69, 0xDE, 0xDE, 0x69, 0xF0, 0x9F, 0x90, 0xBB,
-				1, 0,
-				0x00,
-				0x00, 0x00, 0x00, 0x00, 0x00,
-				'm', 'u', 'l', 't', 'i', 'p', 'l', 'e', ' ', 'p', 'r', 'i', 'm', 'i', 't', 'i', 'v', 'e', 's', 0xFF,
-			},
+		args: map[string]any{"int": 0xDE},
+		expected: []byte{
+			0x69, 0xDE, 0xDE, 0x69, 0xF0, 0x9F, 0x90, 0xBB,
+			1, 0,
+			0x00,
+			0x00, 0x00, 0x00, 0x00, 0x00,
+			's', 'i', 'n', 'g', 'l', 'e', ' ', 'p', 'r', 'i', 'm', 'i', 't', 'i', 'v', 'e', 0xFF,
 		},
-		{
-			name: "mixed with structs",
-			options: &options{
-				version:     1,
-				subversion:  0,
-				compression: false,
-			},
-			args: map[string]any{
-				"string": "moin",
-				"struct": struct {
-					Something bool
-				}{
-					true,
-				},
-			},
-			expected: []byte{
-				0x69, 0xDE, 0xDE, 0x69, 0xF0, 0x9F, 0x90, 0xBB,
-				1, 0,
-				0x00,
-				0x00, 0x00, 0x00, 0x00, 0x00,
-				'm', 'i', 'x', 'e', 'd', ' ', 'w', 'i', 't', 'h', ' ', 's', 't', 'r', 'u', 'c', 't', 's', 0xFF,
-			},
+	},
+	{
+		name: "multiple primitives",
+		options: &options{
+			version:     1,
+			subversion:  0,
+			compression: false,
 		},
-		{
-			name: "simple with compression",
-			options: &options{
-				version:     1,
-				subversion:  0,
-				compression: true,
-			},
-			args: map[string]any{
-				"string": "moin",
-				"int":    0xDE,
-			},
-			expected: []byte{
-				0x69, 0xDE, 0xDE, 0x69, 0xF0, 0x9F, 0x90, 0xBB,
-				1, 0,
-				0x01,
-				0x00, 0x00, 0x00, 0x00, 0x00,
-				's', 'i', 'm', 'p', 'l', 'e', ' ', 'w', 'i', 't', 'h', ' ', 'c', 'o', 'm', 'p', 'r', 'e', 's', 's', 'i', 'o', 'n', 0xFF,
+		args: map[string]any{
+			"int":  0xDE,
+			"bool": true,
+			"str":  "moin",
+		},
+		expected: []byte{
+			0x69, 0xDE, 0xDE, 0x69, 0xF0, 0x9F, 0x90, 0xBB,
+			1, 0,
+			0x00,
+			0x00, 0x00, 0x00, 0x00, 0x00,
+			'm', 'u', 'l', 't', 'i', 'p', 'l', 'e', ' ', 'p', 'r', 'i', 'm', 'i', 't', 'i', 'v', 'e', 's', 0xFF,
+		},
+	},
+	{
+		name: "mixed with structs",
+		options: &options{
+			version:     1,
+			subversion:  0,
+			compression: false,
+		},
+		args: map[string]any{
+			"string": "moin",
+			"struct": struct {
+				Something bool
+			}{
+				true,
 			},
 		},
-	}
+		expected: []byte{
+			0x69, 0xDE, 0xDE, 0x69, 0xF0, 0x9F, 0x90, 0xBB,
+			1, 0,
+			0x00,
+			0x00, 0x00, 0x00, 0x00, 0x00,
+			'm', 'i', 'x', 'e', 'd', ' ', 'w', 'i', 't', 'h', ' ', 's', 't', 'r', 'u', 'c', 't', 's', 0xFF,
+		},
+	},
+	{
+		name: "simple with compression",
+		options: &options{
+			version:     1,
+			subversion:  0,
+			compression: true,
+		},
+		args: map[string]any{
+			"string": "moin",
+			"int":    0xDE,
+		},
+		expected: []byte{
+			0x69, 0xDE, 0xDE, 0x69, 0xF0, 0x9F, 0x90, 0xBB,
+			1, 0,
+			0x01,
+			0x00, 0x00, 0x00, 0x00, 0x00,
+			's', 'i', 'm', 'p', 'l', 'e', ' ', 'w', 'i', 't', 'h', ' ', 'c', 'o', 'm', 'p', 'r', 'e', 's', 's', 'i', 'o', 'n', 0xFF,
+		},
+	},
+}
 
-	for _, test := range tests {
+func TestEncodeFunctionCall(t *testing.T) {
+	for _, test := range encodeFunctionCallTests {
 		t.Run(test.name, func(t *testing.T) {
 			expectedContentBuffer := bytes.NewBuffer(nil)
 
@@ -117,7 +119,7 @@ func TestEncodeFunctionCall(t *testing.T) {
 			var expectedContent []byte
 			var err error
 			if test.options.compression {
-				expectedContent, err = compressBuffer(expectedContentBuffer)
+				expectedContent, err = compressBuffer(expectedContentBuffer, gzipCodec{}, DefaultCompressionLevel)
 				if err != nil {
 					return
 				}
@@ -127,7 +129,7 @@ func TestEncodeFunctionCall(t *testing.T) {
 
 			expectedBuffer := bytes.NewBuffer(test.expected)
 			expectedBuffer.Write(expectedContent)
-			err = writeChecksum(expectedBuffer)
+			err = writeChecksum(expectedBuffer, checksums[ChecksumCRC32])
 			if err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
@@ -258,34 +260,119 @@ func TestEncodeDecodeFunctionCall(t *testing.T) {
 }
 
 func TestCompressDecompressBuffer(t *testing.T) {
-	data := bytes.NewBuffer(nil)
-	for i := 0; i < 32; i++ {
-		data.WriteByte(byte(rand.Intn(255)))
-	}
+	for _, id := range []byte{CodecGzip, CodecZlib, CodecFlate, CodecLZW} {
+		codec, err := codecByID(id)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		data := bytes.NewBuffer(nil)
+		for i := 0; i < 32; i++ {
+			data.WriteByte(byte(rand.Intn(255)))
+		}
+
+		dataCopy := bytes.NewBuffer(data.Bytes())
+		compressed, err := compressBuffer(data, codec, DefaultCompressionLevel)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(compressed) == 0 {
+			t.Fatalf("expected compressed data, got nothing")
+		}
+
+		decompressed, err := decompressBuffer(compressed, codec, DefaultMaxMessageSize)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
 
-	dataCopy := bytes.NewBuffer(data.Bytes())
-	compressed, err := compressBuffer(data)
+		if !bytes.Equal(decompressed.Bytes(), dataCopy.Bytes()) {
+			t.Fatalf(`
+codec %d
+expected:
+%s
+got:
+%s
+		`, id, formatXXD(dataCopy.Bytes()), formatXXD(decompressed.Bytes()))
+		}
+	}
+}
 
+func TestDecodeMalformedFunctionCall(t *testing.T) {
+	valid, err := EncodeFunctionCall("call", Options(RequestID(1)), map[string]any{"a": 1})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	if len(compressed) == 0 {
-		t.Fatalf("expected compressed data, got nothing")
+	tests := []struct {
+		name     string
+		data     []byte
+		sentinel error
+	}{
+		{"empty", []byte{}, ErrInvalidSignature},
+		{"signature only", signature, ErrTruncated},
+		{"header only", valid[:headerSize], ErrTruncated},
+		{"wrong version", withFixedChecksum(append(append(bytes.Clone(valid[:8]), 0x07), valid[9:]...)), ErrInvalidVersion},
+		{"truncated", valid[:len(valid)-1], ErrChecksumMismatch},
+		{"truncated request id", withFixedChecksum(append(bytes.Clone(valid[:headerSize+4]), 0, 0, 0, 0)), ErrTruncated},
+		{"unterminated name", withFixedChecksum(append(bytes.Clone(valid[:headerSize+8]), 'a', 0, 0, 0, 0)), ErrTruncated},
+		{"corrupted argument", withFixedChecksum(append(bytes.Clone(valid[:len(valid)-6]), 0, 0, 0, 0, 0, 0)), ErrChecksumMismatch},
+		{"unknown kind", withFixedChecksum(append(append(bytes.Clone(valid[:11]), 0x07), valid[12:]...)), nil},
 	}
 
-	decompressed, err := decompressBuffer(compressed)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := DecodeFunctionCall(tt.data, Options())
+			var decodingErr *DecodingError
+			if !errors.As(err, &decodingErr) {
+				t.Fatalf("expected DecodingError, got %v", err)
+			}
+			if tt.sentinel != nil && !errors.Is(err, tt.sentinel) {
+				t.Fatalf("expected %v, got %v", tt.sentinel, err)
+			}
+		})
+	}
+}
+
+func TestDecodingErrorPathAndOffset(t *testing.T) {
+	type address struct{ Zip int }
+	type user struct{ Addresses []address }
+
+	data, err := EncodeFunctionCall("call", Options(), map[string]any{
+		"user": user{Addresses: []address{{Zip: 10115}, {Zip: 20095}}},
+	})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	if !bytes.Equal(decompressed.Bytes(), dataCopy.Bytes()) {
-		t.Fatalf(`
-expected:
-%s
-got:
-%s
-		`, formatXXD(dataCopy.Bytes()), formatXXD(decompressed.Bytes()))
+	var target struct {
+		User struct{ Addresses []struct{ Zip string } } `protocol:"user"`
+	}
+	_, err = DecodeFunctionCallInto(data, Options(), &target)
+	var decodingErr *DecodingError
+	if !errors.As(err, &decodingErr) {
+		t.Fatalf("expected DecodingError, got %v", err)
+	}
+	if decodingErr.Path != "user.Addresses[0].Zip" {
+		t.Fatalf("expected path %q, got %q", "user.Addresses[0].Zip", decodingErr.Path)
+	}
+	if zip := binary.BigEndian.Uint64(data[decodingErr.Offset:]); zip != 10115 {
+		t.Fatalf("expected offset %d to point at the zip code, got %d", decodingErr.Offset, zip)
+	}
+	var mismatch *TypeMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("expected TypeMismatchError, got %v", err)
 	}
 
+	offset := bytes.Index(data, binary.BigEndian.AppendUint64(nil, 20095))
+	corrupted := bytes.Clone(data)
+	corrupted[offset] ^= 0xFF
+	_, _, err = DecodeFunctionCall(withFixedChecksum(corrupted), Options())
+	if !errors.Is(err, ErrChecksumMismatch) || !errors.As(err, &decodingErr) {
+		t.Fatalf("expected checksum mismatch, got %v", err)
+	}
+	if decodingErr.Offset != headerSize+len("call")+1 {
+		t.Fatalf("expected offset of the corrupted argument, got %d", decodingErr.Offset)
+	}
 }
@@ -0,0 +1,95 @@
+package protocol
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+func (c *Client) Proxy(target any) error {
+	value, err := targetValue(target)
+	if err != nil {
+		return err
+	}
+	if value.Kind() != reflect.Struct {
+		return &InvalidTargetError{Type: reflect.TypeOf(target)}
+	}
+
+	t := value.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() || field.Type.Kind() != reflect.Func {
+			continue
+		}
+		tag := field.Tag.Get("protocol")
+		if tag == "-" {
+			continue
+		}
+
+		name, argNames, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+		var names []string
+		if argNames != "" {
+			names = strings.Split(argNames, ",")
+		}
+
+		f, err := newFunctionOfType(name, field.Type, reflect.Value{}, names)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		if !f.withError {
+			return fmt.Errorf("field %s: function %q must return an error as its last result", field.Name, name)
+		}
+		err = f.checkTypes()
+		if err != nil {
+			return fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		value.Field(i).Set(reflect.MakeFunc(field.Type, c.proxyCall(f)))
+	}
+
+	return nil
+}
+
+func (c *Client) proxyCall(f *function) func([]reflect.Value) []reflect.Value {
+	return func(in []reflect.Value) []reflect.Value {
+		ctx := context.Background()
+		if f.withContext {
+			if !in[0].IsNil() {
+				ctx = in[0].Interface().(context.Context)
+			}
+			in = in[1:]
+		}
+
+		args := make(map[string]any, len(in))
+		for i, arg := range in {
+			args[f.argNames[i]] = arg.Interface()
+		}
+
+		resultTypes := f.results()
+		out := make([]reflect.Value, len(resultTypes), len(resultTypes)+1)
+		for i, resultType := range resultTypes {
+			out[i] = reflect.New(resultType).Elem()
+		}
+
+		results, err := c.Call(ctx, f.name, args)
+		for i := 0; err == nil && i < len(out); i++ {
+			result, ok := results[resultName(i)]
+			if !ok {
+				err = &MissingArgumentError{Function: f.name, Argument: resultName(i)}
+				break
+			}
+			err = result.DecodeInto(out[i].Addr().Interface())
+		}
+
+		if err != nil {
+			for i, resultType := range resultTypes {
+				out[i] = reflect.Zero(resultType)
+			}
+			return append(out, reflect.ValueOf(&err).Elem())
+		}
+		return append(out, reflect.Zero(errorType))
+	}
+}
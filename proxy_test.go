@@ -0,0 +1,89 @@
+package protocol
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestClientProxy(t *testing.T) {
+	type point struct{ X, Y int }
+
+	server := NewServer(Options())
+	_ = server.Register("add", func(a, b int) int { return a + b }, "a", "b")
+	_ = server.Register("move", func(ctx context.Context, p point, dx int) (point, error) {
+		return point{p.X + dx, p.Y}, nil
+	}, "point", "dx")
+	_ = server.Register("Ping", func() {})
+	_ = server.Register("fail", func() (string, error) { return "", &RemoteError{Code: 42, Message: "rejected"} })
+	client, _ := newTestClient(t, server)
+
+	var api struct {
+		Add     func(a, b int) (int64, error)                              `protocol:"add,a,b"`
+		Move    func(ctx context.Context, p point, dx int8) (point, error) `protocol:"move,point,dx"`
+		Ping    func() error
+		Fail    func() (string, error) `protocol:"fail"`
+		Skipped func()                 `protocol:"-"`
+		Name    string
+	}
+	err := client.Proxy(&api)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if api.Skipped != nil {
+		t.Fatalf("expected skipped field to stay nil")
+	}
+
+	sum, err := api.Add(1, 2)
+	if err != nil || sum != 3 {
+		t.Fatalf("expected 3, got %v, %v", sum, err)
+	}
+
+	p, err := api.Move(context.Background(), point{1, 2}, 3)
+	if err != nil || p != (point{4, 2}) {
+		t.Fatalf("expected {4 2}, got %v, %v", p, err)
+	}
+
+	err = api.Ping()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	s, err := api.Fail()
+	var remoteErr *RemoteError
+	if !errors.As(err, &remoteErr) || remoteErr.Code != 42 || s != "" {
+		t.Fatalf("expected remote error, got %q, %v", s, err)
+	}
+}
+
+func TestClientProxyInvalid(t *testing.T) {
+	client, _ := newTestClient(t, NewServer(Options()))
+
+	tests := []struct {
+		name   string
+		target any
+	}{
+		{"not a pointer", struct{ F func() error }{}},
+		{"not a struct", new(int)},
+		{"no error result", &struct{ F func() int }{}},
+		{"missing argument names", &struct {
+			F func(a int) error `protocol:"f"`
+		}{}},
+		{"too many argument names", &struct {
+			F func(a int) error `protocol:"f,a,b"`
+		}{}},
+		{"unsupported argument", &struct {
+			F func(c chan int) error `protocol:"f,c"`
+		}{}},
+		{"unsupported result", &struct{ F func() (func(), error) }{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := client.Proxy(tt.target)
+			if err == nil {
+				t.Fatalf("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package protocol
+
+import "fmt"
+
+type Message struct {
+	Kind      MessageKind
+	RequestID uint64
+	Name      string
+	Arguments map[string]Argument
+	Err       *RemoteError
+}
+
+func EncodeFunctionResult(name string, options *options, results map[string]any) ([]byte, error) {
+	return encodeMessage(KindResult, name, options, results)
+}
+
+func EncodeFunctionError(name string, options *options, remoteErr *RemoteError) ([]byte, error) {
+	if remoteErr == nil {
+		return nil, fmt.Errorf("function %q: remote error must not be nil", name)
+	}
+	args := map[string]any{
+		"code":    remoteErr.Code,
+		"message": remoteErr.Message,
+	}
+	if remoteErr.Details != nil {
+		args["details"] = remoteErr.Details
+	}
+	return encodeMessage(KindError, name, options, args)
+}
+
+func DecodeFunctionResult(data []byte, options *options) (string, map[string]Argument, error) {
+	message, err := DecodeMessage(data, options)
+	if message == nil {
+		return "", nil, err
+	}
+
+	switch message.Kind {
+	case KindResult:
+		return message.Name, message.Arguments, err
+	case KindError:
+		return message.Name, nil, message.Err
+	}
+	return "", nil, &UnexpectedMessageKindError{Expected: KindResult, Actual: message.Kind}
+}
+
+func DecodeMessage(data []byte, options *options) (*Message, error) {
+	raw, err := readMessage(data, options)
+	if err != nil {
+		return nil, decodingError(err)
+	}
+
+	args, err := decodeArguments(raw, options)
+	if err != nil {
+		return nil, decodingError(err)
+	}
+
+	message := &Message{
+		Kind:      raw.kind,
+		RequestID: raw.requestID,
+		Name:      raw.name,
+		Arguments: args,
+	}
+	if raw.kind == KindError {
+		message.Err, err = remoteErrorFromArguments(args)
+		if err != nil {
+			return nil, decodingError(err)
+		}
+	}
+
+	return message, checkSubversion(options, raw.subversion)
+}
+
+func remoteErrorFromArguments(args map[string]Argument) (*RemoteError, error) {
+	remoteErr := &RemoteError{}
+
+	code, ok := args["code"]
+	if !ok {
+		return nil, fmt.Errorf("error message carries no code")
+	}
+	err := code.DecodeInto(&remoteErr.Code)
+	if err != nil {
+		return nil, err
+	}
+
+	if message, ok := args["message"]; ok {
+		err = message.DecodeInto(&remoteErr.Message)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if details, ok := args["details"]; ok {
+		err = details.DecodeInto(&remoteErr.Details)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return remoteErr, nil
+}
@@ -0,0 +1,189 @@
+package protocol
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestEncodeDecodeFunctionResult(t *testing.T) {
+	options := Options()
+
+	tests := []struct {
+		name    string
+		results map[string]any
+	}{
+		{"no results", nil},
+		{"single result", map[string]any{"0": "moin"}},
+		{"multiple results", map[string]any{"0": int64(42), "1": []string{"a", "b"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := EncodeFunctionResult(tt.name, options, tt.results)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			name, results, err := DecodeFunctionResult(data, options)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if name != tt.name {
+				t.Fatalf("expected name %q, got %q", tt.name, name)
+			}
+			if len(results) != len(tt.results) {
+				t.Fatalf("expected %d results, got %d", len(tt.results), len(results))
+			}
+			for key, value := range tt.results {
+				if !reflect.DeepEqual(results[key].Value, value) {
+					t.Fatalf("expected result %q to be %#v, got %#v", key, value, results[key].Value)
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeDecodeFunctionError(t *testing.T) {
+	options := Options()
+
+	tests := []struct {
+		name      string
+		remoteErr *RemoteError
+	}{
+		{"code and message", &RemoteError{Code: CodeApplication, Message: "broken"}},
+		{"empty message", &RemoteError{Code: 7}},
+		{"details", &RemoteError{Code: CodeInvalidArguments, Message: "invalid", Details: map[string]any{"argument": "s", "limit": int64(3)}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := EncodeFunctionError(tt.name, options, tt.remoteErr)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			name, results, err := DecodeFunctionResult(data, options)
+			var remoteErr *RemoteError
+			if !errors.As(err, &remoteErr) {
+				t.Fatalf("expected remote error, got %v", err)
+			}
+			if name != tt.name {
+				t.Fatalf("expected name %q, got %q", tt.name, name)
+			}
+			if results != nil {
+				t.Fatalf("expected no results, got %v", results)
+			}
+			if !reflect.DeepEqual(remoteErr, tt.remoteErr) {
+				t.Fatalf("expected %#v, got %#v", tt.remoteErr, remoteErr)
+			}
+		})
+	}
+
+	_, err := EncodeFunctionError("nil", options, nil)
+	if err == nil {
+		t.Fatalf("expected error for nil remote error")
+	}
+}
+
+func TestDecodeMessageKind(t *testing.T) {
+	options := Options()
+
+	call, _ := EncodeFunctionCall("call", options, map[string]any{"a": 1})
+	result, _ := EncodeFunctionResult("result", options, map[string]any{"0": 1})
+	failure, _ := EncodeFunctionError("error", options, &RemoteError{Code: CodeInternal, Message: "oh no"})
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected MessageKind
+	}{
+		{"call", call, KindCall},
+		{"result", result, KindResult},
+		{"error", failure, KindError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.data[11] != byte(tt.expected) {
+				t.Fatalf("expected kind byte %d, got %d", tt.expected, tt.data[11])
+			}
+
+			message, err := DecodeMessage(tt.data, options)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if message.Kind != tt.expected {
+				t.Fatalf("expected kind %v, got %v", tt.expected, message.Kind)
+			}
+			if message.Name != tt.name {
+				t.Fatalf("expected name %q, got %q", tt.name, message.Name)
+			}
+			if (message.Err != nil) != (tt.expected == KindError) {
+				t.Fatalf("unexpected remote error %v", message.Err)
+			}
+		})
+	}
+
+	var unexpected *UnexpectedMessageKindError
+	_, _, err := DecodeFunctionCall(result, options)
+	if !errors.As(err, &unexpected) || unexpected.Actual != KindResult {
+		t.Fatalf("expected unexpected message kind error, got %v", err)
+	}
+	_, err = DecodeFunctionCallInto(failure, options, map[string]any{})
+	if !errors.As(err, &unexpected) || unexpected.Actual != KindError {
+		t.Fatalf("expected unexpected message kind error, got %v", err)
+	}
+	_, _, err = DecodeFunctionResult(call, options)
+	if !errors.As(err, &unexpected) || unexpected.Actual != KindCall {
+		t.Fatalf("expected unexpected message kind error, got %v", err)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name      string
+		requestID uint64
+		flags     byte
+	}{
+		{"no id", 0, 0},
+		{"small id", 1, flagRequestID},
+		{"large id", 0xDEADBEEFCAFEBABE, flagRequestID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := Options(RequestID(tt.requestID))
+			data, err := EncodeFunctionCall("call", options, map[string]any{"a": 1})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if data[12] != tt.flags {
+				t.Fatalf("expected flags %08b, got %08b", tt.flags, data[12])
+			}
+
+			message, err := DecodeMessage(data, Options())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if message.RequestID != tt.requestID {
+				t.Fatalf("expected request id %d, got %d", tt.requestID, message.RequestID)
+			}
+
+			name, args, err := DecodeFunctionCall(data, Options())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if name != "call" || args["a"].Value != 1 {
+				t.Fatalf("unexpected call %q %v", name, args)
+			}
+		})
+	}
+
+	data, _ := EncodeFunctionCall("call", Options(), nil)
+	data[12] = 0x80
+	_, err := DecodeMessage(data, Options())
+	if err == nil {
+		t.Fatalf("expected error for unknown header flags")
+	}
+}
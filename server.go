@@ -0,0 +1,312 @@
+package protocol
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+type Server struct {
+	options   *options
+	mu        sync.RWMutex
+	functions map[string]*function
+}
+
+type function struct {
+	name        string
+	typ         reflect.Type
+	fn          reflect.Value
+	argNames    []string
+	withContext bool
+	withError   bool
+}
+
+func NewServer(options *options) *Server {
+	s := &Server{
+		options:   options,
+		functions: make(map[string]*function),
+	}
+	s.functions[DescribeFunction], _ = newFunction(DescribeFunction, reflect.ValueOf(s.describe), nil)
+	return s
+}
+
+func (s *Server) Register(name string, fn any, argNames ...string) error {
+	f, err := newFunction(name, reflect.ValueOf(fn), argNames)
+	if err != nil {
+		return err
+	}
+	err = f.checkTypes()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.functions[name]; ok {
+		return fmt.Errorf("function %q is already registered", name)
+	}
+	s.functions[name] = f
+	return nil
+}
+
+func newFunction(name string, fn reflect.Value, argNames []string) (*function, error) {
+	if fn.Kind() != reflect.Func || fn.IsNil() {
+		return nil, fmt.Errorf("function %q: expected a func, got %v", name, fn.Kind())
+	}
+	return newFunctionOfType(name, fn.Type(), fn, argNames)
+}
+
+func newFunctionOfType(name string, t reflect.Type, fn reflect.Value, argNames []string) (*function, error) {
+	if t.IsVariadic() {
+		return nil, fmt.Errorf("function %q: variadic functions are not supported", name)
+	}
+
+	f := &function{
+		name:        name,
+		typ:         t,
+		fn:          fn,
+		argNames:    argNames,
+		withContext: t.NumIn() > 0 && t.In(0) == contextType,
+		withError:   t.NumOut() > 0 && t.Out(t.NumOut()-1) == errorType,
+	}
+
+	if len(argNames) != len(f.params()) {
+		return nil, fmt.Errorf("function %q: expected %d argument names, got %d", name, len(f.params()), len(argNames))
+	}
+	seen := make(map[string]bool)
+	for _, argName := range argNames {
+		if seen[argName] {
+			return nil, fmt.Errorf("function %q: duplicate argument name %q", name, argName)
+		}
+		seen[argName] = true
+	}
+
+	return f, nil
+}
+
+func (f *function) checkTypes() error {
+	for i, param := range f.params() {
+		err := checkSupportedType(param, make(map[reflect.Type]bool))
+		if err != nil {
+			return fmt.Errorf("function %q: argument %q: %w", f.name, f.argNames[i], err)
+		}
+	}
+	for i, result := range f.results() {
+		err := checkSupportedType(result, make(map[reflect.Type]bool))
+		if err != nil {
+			return fmt.Errorf("function %q: result %d: %w", f.name, i, err)
+		}
+	}
+	return nil
+}
+
+func (f *function) params() []reflect.Type {
+	t := f.typ
+	params := make([]reflect.Type, 0, t.NumIn())
+	for i := 0; i < t.NumIn(); i++ {
+		if i == 0 && f.withContext {
+			continue
+		}
+		params = append(params, t.In(i))
+	}
+	return params
+}
+
+func (f *function) results() []reflect.Type {
+	t := f.typ
+	results := make([]reflect.Type, 0, t.NumOut())
+	for i := 0; i < t.NumOut(); i++ {
+		if i == t.NumOut()-1 && f.withError {
+			continue
+		}
+		results = append(results, t.Out(i))
+	}
+	return results
+}
+
+func (s *Server) Handle(ctx context.Context, data []byte) ([]byte, error) {
+	message, err := readMessage(data, s.options)
+	if err != nil {
+		return nil, decodingError(err)
+	}
+	if message.kind != KindCall {
+		return nil, &UnexpectedMessageKindError{Expected: KindCall, Actual: message.kind}
+	}
+	name := message.name
+	options := s.options.with(RequestID(message.requestID))
+
+	s.mu.RLock()
+	f, ok := s.functions[name]
+	s.mu.RUnlock()
+	if !ok {
+		return EncodeFunctionError(name, options, newRemoteError(CodeUnknownFunction, &UnknownFunctionError{Name: name}))
+	}
+
+	args, err := f.bind(message, s.options)
+	if err != nil {
+		return EncodeFunctionError(name, options, newRemoteError(CodeInvalidArguments, err))
+	}
+
+	results, err := f.call(ctx, args)
+	if err != nil {
+		return EncodeFunctionError(name, options, newRemoteError(CodeApplication, err))
+	}
+
+	response, err := EncodeFunctionResult(name, options, results)
+	if err != nil {
+		return EncodeFunctionError(name, options, newRemoteError(CodeInternal, err))
+	}
+	return response, nil
+}
+
+func (s *Server) ServeConn(ctx context.Context, conn io.ReadWriter) error {
+	encoder := NewEncoder(conn, s.options)
+	decoder := NewDecoder(conn, s.options)
+
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+
+	for {
+		data, err := decoder.ReadMessage()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			response, err := s.Handle(ctx, data)
+			if err != nil {
+				var ok bool
+				response, ok = s.failureResponse(data, err)
+				if !ok {
+					if closer, ok := conn.(io.Closer); ok {
+						_ = closer.Close()
+					}
+					return
+				}
+			}
+			if response != nil {
+				_ = encoder.WriteMessage(response)
+			}
+		}()
+	}
+}
+
+// failureResponse answers a call that Handle could not read with an error
+// response, as long as its header still names the request it belongs to.
+// Messages other than calls are not answered.
+func (s *Server) failureResponse(data []byte, err error) ([]byte, bool) {
+	kind, requestID, ok := readRequestID(data)
+	if !ok {
+		return nil, false
+	}
+	if kind != KindCall {
+		return nil, true
+	}
+	response, err := EncodeFunctionError("", s.options.with(RequestID(requestID)), newRemoteError(CodeInvalidArguments, err))
+	return response, err == nil
+}
+
+func newRemoteError(code int, err error) *RemoteError {
+	var remoteErr *RemoteError
+	if errors.As(err, &remoteErr) {
+		return remoteErr
+	}
+	return &RemoteError{Code: code, Message: err.Error()}
+}
+
+func (f *function) bind(message *rawMessage, options *options) ([]reflect.Value, error) {
+	params := f.params()
+	args := make([]reflect.Value, len(params))
+	for i, param := range params {
+		args[i] = reflect.New(param).Elem()
+	}
+
+	bound := make([]bool, len(params))
+	state := newMessageState(message, options)
+	offset := message.argumentsOffset
+	for _, argData := range message.arguments {
+		argState := state.at(offset)
+		offset += len(argData)
+		argName, typ, content, err := readArgument(argData, argState)
+		if err != nil {
+			return nil, err
+		}
+
+		i := f.argIndex(argName)
+		if i < 0 {
+			return nil, &UnexpectedArgumentError{Function: f.name, Argument: argName}
+		}
+		argState, err = argState.field(argName)
+		if err != nil {
+			return nil, err
+		}
+		err = decodeContentInto(typ, content, args[i], argState.content(argData, content))
+		if err != nil {
+			return nil, err
+		}
+		bound[i] = true
+	}
+
+	for i, ok := range bound {
+		if !ok {
+			return nil, &MissingArgumentError{Function: f.name, Argument: f.argNames[i]}
+		}
+	}
+	return args, nil
+}
+
+func (f *function) argIndex(argName string) int {
+	for i, name := range f.argNames {
+		if name == argName {
+			return i
+		}
+	}
+	return -1
+}
+
+func (f *function) call(ctx context.Context, args []reflect.Value) (results map[string]any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &RemoteError{Code: CodeInternal, Message: fmt.Sprintf("function %q panicked: %v", f.name, r)}
+		}
+	}()
+
+	if f.withContext {
+		args = append([]reflect.Value{reflect.ValueOf(ctx)}, args...)
+	}
+	out := f.fn.Call(args)
+
+	if f.withError {
+		last := out[len(out)-1]
+		out = out[:len(out)-1]
+		if !last.IsNil() {
+			return nil, last.Interface().(error)
+		}
+	}
+
+	results = make(map[string]any, len(out))
+	for i, result := range out {
+		results[resultName(i)] = result.Interface()
+	}
+	return results, nil
+}
+
+func resultName(i int) string {
+	return strconv.Itoa(i)
+}
@@ -0,0 +1,282 @@
+package protocol
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServerHandle(t *testing.T) {
+	options := Options()
+	server := NewServer(options)
+
+	type point struct{ X, Y int }
+
+	err := server.Register("add", func(a, b int64) int64 { return a + b }, "a", "b")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = server.Register("move", func(ctx context.Context, p point, dx int) (point, error) {
+		return point{p.X + dx, p.Y}, nil
+	}, "point", "dx")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = server.Register("split", func(s string) (string, string) {
+		before, after, _ := strings.Cut(s, ",")
+		return before, after
+	}, "s")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		function string
+		args     map[string]any
+		expected map[string]any
+	}{
+		{"conversion", "add", map[string]any{"a": byte(1), "b": 2}, map[string]any{"0": int64(3)}},
+		{"struct and context", "move", map[string]any{"point": point{1, 2}, "dx": int8(3)}, map[string]any{"0": struct{ X, Y int }{4, 2}}},
+		{"multiple results", "split", map[string]any{"s": "moin,dikka"}, map[string]any{"0": "moin", "1": "dikka"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			call, err := EncodeFunctionCall(tt.function, options, tt.args)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			response, err := server.Handle(context.Background(), call)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			name, results, err := DecodeFunctionResult(response, options)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if name != tt.function {
+				t.Fatalf("expected name %q, got %q", tt.function, name)
+			}
+			if len(results) != len(tt.expected) {
+				t.Fatalf("expected %d results, got %d", len(tt.expected), len(results))
+			}
+			for key, value := range tt.expected {
+				if !reflect.DeepEqual(results[key].Value, value) {
+					t.Fatalf("expected result %q to be %#v, got %#v", key, value, results[key].Value)
+				}
+			}
+		})
+	}
+}
+
+func TestServerHandleErrors(t *testing.T) {
+	options := Options()
+	server := NewServer(options)
+
+	errBroken := errors.New("broken")
+	_ = server.Register("echo", func(s string) string { return s }, "s")
+	_ = server.Register("fail", func() error { return errBroken })
+	_ = server.Register("reject", func() error { return &RemoteError{Code: 42, Message: "rejected"} })
+	_ = server.Register("panic", func() int { panic("oh no") })
+	_ = server.Register("unencodable", func() any { return make(chan int) })
+
+	tests := []struct {
+		name     string
+		function string
+		args     map[string]any
+		code     int
+		message  string
+	}{
+		{"unknown function", "missing", nil, CodeUnknownFunction, `unknown function "missing"`},
+		{"missing argument", "echo", nil, CodeInvalidArguments, `missing argument "s"`},
+		{"unexpected argument", "echo", map[string]any{"s": "moin", "t": "dikka"}, CodeInvalidArguments, `unexpected argument "t"`},
+		{"type mismatch", "echo", map[string]any{"s": 1}, CodeInvalidArguments, `at "s"`},
+		{"returned error", "fail", nil, CodeApplication, "broken"},
+		{"remote error", "reject", nil, 42, "rejected"},
+		{"panic", "panic", nil, CodeInternal, "oh no"},
+		{"unencodable result", "unencodable", nil, CodeInternal, "unsupported type: chan"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			call, err := EncodeFunctionCall(tt.function, options, tt.args)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			response, err := server.Handle(context.Background(), call)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			name, _, err := DecodeFunctionResult(response, options)
+			var remoteErr *RemoteError
+			if !errors.As(err, &remoteErr) {
+				t.Fatalf("expected remote error, got %v", err)
+			}
+			if name != tt.function {
+				t.Fatalf("expected name %q, got %q", tt.function, name)
+			}
+			if remoteErr.Code != tt.code {
+				t.Fatalf("expected code %d, got %d", tt.code, remoteErr.Code)
+			}
+			if !strings.Contains(remoteErr.Message, tt.message) {
+				t.Fatalf("expected message to contain %q, got %q", tt.message, remoteErr.Message)
+			}
+		})
+	}
+
+	response, err := EncodeFunctionResult("echo", options, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = server.Handle(context.Background(), response)
+	var unexpected *UnexpectedMessageKindError
+	if !errors.As(err, &unexpected) || unexpected.Actual != KindResult {
+		t.Fatalf("expected unexpected message kind error, got %v", err)
+	}
+}
+
+func TestServerHandleRequestID(t *testing.T) {
+	options := Options()
+	server := NewServer(options)
+	_ = server.Register("echo", func(s string) string { return s }, "s")
+
+	call, err := EncodeFunctionCall("echo", Options(RequestID(7)), map[string]any{"s": "moin"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	response, err := server.Handle(context.Background(), call)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	message, err := DecodeMessage(response, options)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if message.RequestID != 7 {
+		t.Fatalf("expected request id 7, got %d", message.RequestID)
+	}
+}
+
+func TestServerRegister(t *testing.T) {
+	server := NewServer(Options())
+
+	tests := []struct {
+		name     string
+		fn       any
+		argNames []string
+	}{
+		{"not a func", 42, nil},
+		{"nil func", (func())(nil), nil},
+		{"variadic", func(...int) {}, []string{"a"}},
+		{"too few names", func(a, b int) {}, []string{"a"}},
+		{"too many names", func(ctx context.Context, a int) {}, []string{"a", "b"}},
+		{"duplicate names", func(a, b int) {}, []string{"a", "a"}},
+		{"unsupported argument", func(c chan int) {}, []string{"c"}},
+		{"unsupported result", func() (func(), error) { return nil, nil }, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := server.Register(tt.name, tt.fn, tt.argNames...)
+			if err == nil {
+				t.Fatalf("expected error")
+			}
+		})
+	}
+
+	err := server.Register("twice", func() {})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = server.Register("twice", func() {})
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestServerServeConnCancel(t *testing.T) {
+	options := Options()
+	server := NewServer(options)
+
+	started := make(chan struct{})
+	cancelled := make(chan error, 1)
+	_ = server.Register("wait", func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+		cancelled <- ctx.Err()
+	})
+
+	clientConn, serverConn := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- server.ServeConn(context.Background(), serverConn)
+	}()
+
+	call, err := EncodeFunctionCall("wait", options, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = NewEncoder(clientConn, options).WriteMessage(call)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	<-started
+	clientConn.Close()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("ServeConn did not return after the connection dropped")
+	}
+	if err := <-cancelled; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected canceled, got %v", err)
+	}
+}
+
+func TestServerServeConnUnreadableHeader(t *testing.T) {
+	options := Options()
+	server := NewServer(options)
+
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	done := make(chan error, 1)
+	go func() {
+		done <- server.ServeConn(context.Background(), serverConn)
+	}()
+
+	valid, err := EncodeFunctionCall("call", Options(RequestID(1)), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	truncated := withFixedChecksum(append(bytes.Clone(valid[:headerSize+4]), 0, 0, 0, 0))
+	err = NewEncoder(clientConn, options).WriteMessage(truncated)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatalf("expected error after closing the connection")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("ServeConn did not close the connection")
+	}
+	_, err = NewDecoder(clientConn, options).ReadMessage()
+	if err == nil {
+		t.Fatalf("expected closed connection")
+	}
+}
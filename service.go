@@ -0,0 +1,147 @@
+package protocol
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+type ServiceDescriptor interface {
+	ProtocolArgumentNames() map[string][]string
+}
+
+var serviceDescriptorType = reflect.TypeOf((*ServiceDescriptor)(nil)).Elem()
+
+func (s *Server) RegisterService(service any) error {
+	value := reflect.ValueOf(service)
+	if !value.IsValid() || value.Kind() == reflect.Ptr && value.IsNil() {
+		return fmt.Errorf("service must not be nil")
+	}
+	serviceName := reflect.Indirect(value).Type().Name()
+	if serviceName == "" {
+		return fmt.Errorf("service of type %v has no name", value.Type())
+	}
+
+	var argNames map[string][]string
+	if descriptor, ok := service.(ServiceDescriptor); ok {
+		argNames = descriptor.ProtocolArgumentNames()
+	}
+
+	t := value.Type()
+	for methodName := range argNames {
+		if _, ok := t.MethodByName(methodName); !ok {
+			return fmt.Errorf("service %s: argument names given for unknown method %q", serviceName, methodName)
+		}
+	}
+
+	functions := make([]*function, 0, t.NumMethod())
+	for i := 0; i < t.NumMethod(); i++ {
+		method := t.Method(i)
+		if t.Implements(serviceDescriptorType) && method.Name == "ProtocolArgumentNames" {
+			continue
+		}
+
+		fn := value.Method(i)
+		names, ok := argNames[method.Name]
+		if !ok {
+			names = positionalArgNames(fn.Type())
+		}
+		f, err := newServiceMethod(serviceName+"."+method.Name, fn, names)
+		if err != nil {
+			return err
+		}
+		functions = append(functions, f)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, f := range functions {
+		if _, ok := s.functions[f.name]; ok {
+			return fmt.Errorf("function %q is already registered", f.name)
+		}
+	}
+	for _, f := range functions {
+		s.functions[f.name] = f
+	}
+	return nil
+}
+
+func positionalArgNames(t reflect.Type) []string {
+	names := make([]string, 0, t.NumIn())
+	for i := 0; i < t.NumIn(); i++ {
+		if i == 0 && t.In(i) == contextType {
+			continue
+		}
+		names = append(names, strconv.Itoa(len(names)))
+	}
+	return names
+}
+
+func newServiceMethod(name string, fn reflect.Value, argNames []string) (*function, error) {
+	f, err := newFunction(name, fn, argNames)
+	if err != nil {
+		return nil, err
+	}
+	if !f.withError {
+		return nil, fmt.Errorf("function %q: expected error as the last result", name)
+	}
+
+	for _, param := range f.params() {
+		if param == contextType {
+			return nil, fmt.Errorf("function %q: context.Context must be the first parameter", name)
+		}
+	}
+	for _, result := range f.results() {
+		if result == errorType {
+			return nil, fmt.Errorf("function %q: error must be the last result", name)
+		}
+	}
+	err = f.checkTypes()
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func checkSupportedType(t reflect.Type, visited map[reflect.Type]bool) error {
+	if isRecursivePointer(t) {
+		return &UnsupportedTypeError{Kind: t.Kind()}
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if visited[t] || t.Kind() == reflect.Interface {
+		return nil
+	}
+	visited[t] = true
+
+	typeTag, ok := TypeToTypeTag(t)
+	if !ok {
+		return &UnsupportedTypeError{Kind: t.Kind()}
+	}
+	if _, ok := builtinTypeTags[t]; ok {
+		return nil
+	}
+	if _, ok := marshalerTypeTag(t); ok {
+		return nil
+	}
+
+	switch typeTag {
+	case TypeStruct:
+		for _, field := range cachedStructFields(t).list {
+			err := checkSupportedType(t.FieldByIndex(field.index).Type, visited)
+			if err != nil {
+				return err
+			}
+		}
+	case TypeSlice:
+		return checkSupportedType(t.Elem(), visited)
+	case TypeMap, TypeMapStringKey:
+		err := checkSupportedType(t.Key(), visited)
+		if err != nil {
+			return err
+		}
+		return checkSupportedType(t.Elem(), visited)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package protocol
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type testCalculator struct {
+	offset int
+}
+
+func (c *testCalculator) ProtocolArgumentNames() map[string][]string {
+	return map[string][]string{
+		"Add": {"a", "b"},
+	}
+}
+
+func (c *testCalculator) Add(ctx context.Context, a, b int) (int, error) {
+	return a + b + c.offset, nil
+}
+
+func (c *testCalculator) Negate(a int) (int, error) {
+	return -a, nil
+}
+
+func (c *testCalculator) Fail() error {
+	return errors.New("broken")
+}
+
+type testContextNotFirst struct{}
+
+func (testContextNotFirst) Call(a int, ctx context.Context) error { return nil }
+
+type testNoError struct{}
+
+func (testNoError) Call() int { return 0 }
+
+type testErrorNotLast struct{}
+
+func (testErrorNotLast) Call() (error, int) { return nil, 0 }
+
+type testUnsupportedArgument struct{}
+
+func (testUnsupportedArgument) Call(c chan int) error { return nil }
+
+type testUnsupportedField struct{}
+
+func (testUnsupportedField) Call() (struct{ F func() }, error) { return struct{ F func() }{}, nil }
+
+type testUnknownMethod struct{}
+
+func (testUnknownMethod) ProtocolArgumentNames() map[string][]string {
+	return map[string][]string{"Missing": nil}
+}
+
+func TestServerRegisterService(t *testing.T) {
+	options := Options()
+	server := NewServer(options)
+	err := server.RegisterService(&testCalculator{offset: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		function string
+		args     map[string]any
+		expected any
+		message  string
+	}{
+		{"named arguments", "testCalculator.Add", map[string]any{"a": 1, "b": 2}, 4, ""},
+		{"positional arguments", "testCalculator.Negate", map[string]any{"0": 3}, -3, ""},
+		{"error", "testCalculator.Fail", nil, nil, "broken"},
+		{"descriptor not exposed", "testCalculator.ProtocolArgumentNames", nil, nil, "unknown function"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			call, err := EncodeFunctionCall(tt.function, options, tt.args)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			response, err := server.Handle(context.Background(), call)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			_, results, err := DecodeFunctionResult(response, options)
+			if tt.message != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.message) {
+					t.Fatalf("expected error containing %q, got %v", tt.message, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if results["0"].Value != tt.expected {
+				t.Fatalf("expected %v, got %v", tt.expected, results["0"].Value)
+			}
+		})
+	}
+
+	err = server.RegisterService(&testCalculator{})
+	if err == nil {
+		t.Fatalf("expected error for duplicate registration")
+	}
+}
+
+func TestServerRegisterServiceInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		service any
+	}{
+		{"nil", nil},
+		{"nil pointer", (*testCalculator)(nil)},
+		{"unnamed type", struct{}{}},
+		{"context not first", testContextNotFirst{}},
+		{"no error", testNoError{}},
+		{"error not last", testErrorNotLast{}},
+		{"unsupported argument", testUnsupportedArgument{}},
+		{"unsupported nested field", testUnsupportedField{}},
+		{"unknown method", testUnknownMethod{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer(Options())
+			err := server.RegisterService(tt.service)
+			if err == nil {
+				t.Fatalf("expected error")
+			}
+			if len(server.functions) != 1 {
+				t.Fatalf("expected only the built-in functions, got %d", len(server.functions))
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+)
+
+const DefaultMaxMessageSize = 16 << 20
+
+type Encoder struct {
+	w       io.Writer
+	options *options
+	mu      sync.Mutex
+}
+
+func NewEncoder(w io.Writer, options *options) *Encoder {
+	return &Encoder{w: w, options: options}
+}
+
+func (e *Encoder) Encode(name string, args map[string]any) error {
+	message, err := EncodeFunctionCall(name, e.options, args)
+	if err != nil {
+		return err
+	}
+	return e.WriteMessage(message)
+}
+
+func (e *Encoder) WriteMessage(message []byte) error {
+	limit := maxFrameSize(e.options)
+	if len(message) > limit {
+		return &MessageTooLargeError{Size: len(message), Limit: limit}
+	}
+
+	frame := make([]byte, 4, 4+len(message))
+	binary.BigEndian.PutUint32(frame, uint32(len(message)))
+	frame = append(frame, message...)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err := e.w.Write(frame)
+	return err
+}
+
+// maxFrameSize caps the message size limit at what the 4 byte length prefix
+// of a frame can hold.
+func maxFrameSize(options *options) int {
+	return int(min(uint64(options.maxMessageSizeOrDefault()), math.MaxUint32))
+}
+
+type Decoder struct {
+	r       io.Reader
+	options *options
+	mu      sync.Mutex
+}
+
+func NewDecoder(r io.Reader, options *options) *Decoder {
+	return &Decoder{r: r, options: options}
+}
+
+func (d *Decoder) Decode() (string, map[string]Argument, error) {
+	message, err := d.ReadMessage()
+	if err != nil {
+		return "", nil, err
+	}
+	return DecodeFunctionCall(message, d.options)
+}
+
+func (d *Decoder) DecodeInto(target any) (string, error) {
+	message, err := d.ReadMessage()
+	if err != nil {
+		return "", err
+	}
+	return DecodeFunctionCallInto(message, d.options, target)
+}
+
+func (d *Decoder) DecodeMessage() (*Message, error) {
+	message, err := d.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	return DecodeMessage(message, d.options)
+}
+
+func (d *Decoder) ReadMessage() ([]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	prefix := make([]byte, 4)
+	_, err := io.ReadFull(d.r, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	size := int64(binary.BigEndian.Uint32(prefix))
+	if size > int64(d.options.maxMessageSizeOrDefault()) {
+		return nil, &MessageTooLargeError{Size: int(size), Limit: d.options.maxMessageSizeOrDefault()}
+	}
+
+	message := make([]byte, size)
+	_, err = io.ReadFull(d.r, message)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = verifyMessage(message)
+	if err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+func verifyMessage(message []byte) error {
+	if len(message) < len(signature) || !bytes.Equal(message[:len(signature)], signature) {
+		return &DecodingError{err: ErrInvalidSignature}
+	}
+	if len(message) < headerSize {
+		return &DecodingError{Offset: len(message), err: fmt.Errorf("%w: message too short: %d bytes", ErrTruncated, len(message))}
+	}
+	algorithm, err := checksumByID(message[checksumOffset])
+	if err != nil {
+		return &DecodingError{Offset: checksumOffset, err: err}
+	}
+	if len(message) < headerSize+algorithm.size {
+		return &DecodingError{Offset: len(message), err: fmt.Errorf("%w: message too short: %d bytes", ErrTruncated, len(message))}
+	}
+	checksumStart := len(message) - algorithm.size
+	if !verifyChecksum(message[:checksumStart], message[checksumStart:], algorithm) {
+		return &DecodingError{Offset: checksumStart, err: fmt.Errorf("message %w", ErrChecksumMismatch)}
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestEncoderDecoder(t *testing.T) {
+	calls := []struct {
+		name string
+		args map[string]any
+	}{
+		{"first", map[string]any{"int": 1, "str": "moin"}},
+		{"second", map[string]any{}},
+		{"third", map[string]any{"data": bytes.Repeat([]byte{0xDE}, 1024)}},
+	}
+
+	for _, compression := range []bool{false, true} {
+		options := Options(Compression(compression))
+		stream := bytes.NewBuffer(nil)
+		encoder := NewEncoder(stream, options)
+		for _, call := range calls {
+			err := encoder.Encode(call.name, call.args)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+
+		decoder := NewDecoder(stream, options)
+		for _, call := range calls {
+			name, args, err := decoder.Decode()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if name != call.name {
+				t.Fatalf("expected name %q, got %q", call.name, name)
+			}
+			if len(args) != len(call.args) {
+				t.Fatalf("expected %d arguments, got %d", len(call.args), len(args))
+			}
+			for key, value := range call.args {
+				if !reflect.DeepEqual(args[key].Value, value) {
+					t.Fatalf("expected argument %q to be %v, got %v", key, value, args[key].Value)
+				}
+			}
+		}
+
+		_, _, err := decoder.Decode()
+		if err != io.EOF {
+			t.Fatalf("expected EOF, got: %v", err)
+		}
+	}
+}
+
+func TestEncoderDecoderPipe(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	options := Options()
+	go func() {
+		encoder := NewEncoder(client, options)
+		for i := 0; i < 3; i++ {
+			_ = encoder.Encode("ping", map[string]any{"seq": i})
+		}
+	}()
+
+	decoder := NewDecoder(server, options)
+	for i := 0; i < 3; i++ {
+		var call struct {
+			Seq int `protocol:"seq"`
+		}
+		name, err := decoder.DecodeInto(&call)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if name != "ping" || call.Seq != i {
+			t.Fatalf("expected ping %d, got %s %d", i, name, call.Seq)
+		}
+	}
+}
+
+func TestDecoderInvalidFrames(t *testing.T) {
+	message, err := EncodeFunctionCall("call", Options(), map[string]any{"str": "moin"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	frame := func(message []byte) []byte {
+		stream := bytes.NewBuffer(nil)
+		err := NewEncoder(stream, Options(MaxMessageSize(1<<30))).WriteMessage(message)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return stream.Bytes()
+	}
+
+	corrupted := bytes.Clone(message)
+	corrupted[len(corrupted)-6] ^= 0xFF
+
+	wrongSignature := bytes.Clone(message)
+	wrongSignature[0] = 0x00
+
+	tests := []struct {
+		name    string
+		stream  []byte
+		options *options
+		check   func(error) bool
+	}{
+		{"too large", frame(message), Options(MaxMessageSize(len(message) - 1)), func(err error) bool {
+			var tooLarge *MessageTooLargeError
+			return errors.As(err, &tooLarge) && tooLarge.Size == len(message)
+		}},
+		{"truncated", frame(message)[:len(message)-2], Options(), func(err error) bool {
+			return err == io.ErrUnexpectedEOF
+		}},
+		{"checksum", frame(corrupted), Options(), func(err error) bool {
+			return err != nil
+		}},
+		{"signature", frame(wrongSignature), Options(), func(err error) bool {
+			return err != nil
+		}},
+		{"short", frame(signature), Options(), func(err error) bool {
+			return err != nil
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewDecoder(bytes.NewReader(tt.stream), tt.options).ReadMessage()
+			if !tt.check(err) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+
+	t.Run("encoder limit", func(t *testing.T) {
+		err := NewEncoder(io.Discard, Options(MaxMessageSize(8))).WriteMessage(message)
+		var tooLarge *MessageTooLargeError
+		if !errors.As(err, &tooLarge) {
+			t.Fatalf("expected MessageTooLargeError, got: %v", err)
+		}
+	})
+}
+
+func TestMaxFrameSize(t *testing.T) {
+	if maxFrameSize(Options()) != DefaultMaxMessageSize {
+		t.Fatalf("expected %d, got %d", DefaultMaxMessageSize, maxFrameSize(Options()))
+	}
+	expected := min(uint64(math.MaxInt), math.MaxUint32)
+	if got := uint64(maxFrameSize(Options(MaxMessageSize(math.MaxInt)))); got != expected {
+		t.Fatalf("expected %d, got %d", expected, got)
+	}
+}
@@ -0,0 +1,47 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+var builtinTypeTags = map[reflect.Type]byte{
+	timeType:     TypeTime,
+	durationType: TypeDuration,
+}
+
+func encodeTime(t time.Time) []byte {
+	content := make([]byte, 12)
+	binary.BigEndian.PutUint64(content, uint64(t.Unix()))
+	binary.BigEndian.PutUint32(content[8:], uint32(t.Nanosecond()))
+	if t.Location() == time.UTC {
+		return content
+	}
+
+	zone, offset := t.Zone()
+	content = binary.BigEndian.AppendUint32(content, uint32(int32(offset)))
+	return append(content, zone...)
+}
+
+func decodeTime(content []byte) (time.Time, error) {
+	if len(content) != 12 && len(content) < 16 {
+		return time.Time{}, fmt.Errorf("invalid time content length: %d", len(content))
+	}
+
+	seconds := int64(binary.BigEndian.Uint64(content))
+	nanoseconds := int64(binary.BigEndian.Uint32(content[8:]))
+	t := time.Unix(seconds, nanoseconds).UTC()
+	if len(content) == 12 {
+		return t, nil
+	}
+
+	offset := int(int32(binary.BigEndian.Uint32(content[12:])))
+	return t.In(time.FixedZone(string(content[16:]), offset)), nil
+}